@@ -0,0 +1,113 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+var AccessReportCmd = &cobra.Command{
+	Use:   "report <parcelID>",
+	Short: "Pending requests and granted usages of a data parcel",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  accessReportFunc,
+}
+
+// accessReport is everyone who asked for or was given a parcel.
+type accessReport struct {
+	Parcel   string             `json:"parcel"`
+	Owner    string             `json:"owner"`
+	Requests []*types.RequestEx `json:"requests"`
+	Usages   []*types.UsageEx   `json:"usages"`
+}
+
+func accessReportFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if rpc.DryRun {
+		return printRaw(rpc.QueryParcel(context.Background(), args[0]))
+	}
+
+	parcel, err := rpc.GetParcel(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no parcel")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	report := accessReport{
+		Parcel:   strings.ToUpper(args[0]),
+		Owner:    parcel.Owner.String(),
+		Requests: parcel.Requests,
+		Usages:   parcel.Usages,
+	}
+	if report.Requests == nil {
+		report.Requests = []*types.RequestEx{}
+	}
+	if report.Usages == nil {
+		report.Usages = []*types.UsageEx{}
+	}
+
+	if asJson {
+		b, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("parcel: %s\n", report.Parcel)
+	fmt.Printf("owner: %s\n", report.Owner)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\npending requests: %d\n", len(report.Requests))
+	if len(report.Requests) > 0 {
+		fmt.Fprintln(w, "  recipient\tpayment\tagency\tdealer\tdealer_fee")
+	}
+	for _, r := range report.Requests {
+		if r.Request == nil {
+			fmt.Fprintf(w, "  %s\t-\t-\t-\t-\n", r.Recipient)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", r.Recipient,
+			r.Payment.String(), orNone(r.Agency.String()),
+			orNone(r.Dealer.String()), r.DealerFee.String())
+	}
+	fmt.Fprintf(w, "\ngranted usages: %d\n", len(report.Usages))
+	if len(report.Usages) > 0 {
+		fmt.Fprintln(w, "  recipient\tcustody")
+	}
+	for _, u := range report.Usages {
+		if u.Usage == nil {
+			fmt.Fprintf(w, "  %s\t-\n", u.Recipient)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", u.Recipient, u.Custody)
+	}
+
+	return w.Flush()
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	ParcelCmd.AddCommand(AccessReportCmd)
+}
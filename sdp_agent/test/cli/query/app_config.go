@@ -1,6 +1,7 @@
 package query
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -19,7 +20,7 @@ var UdcCmd = &cobra.Command{
 
 func appConfigFunc(cmd *cobra.Command, args []string) error {
 	// TODO: do some sanity check on client side
-	res, err := rpc.QueryAppConfig()
+	res, err := rpc.QueryAppConfig(context.Background())
 	if err != nil {
 		return err
 	}
@@ -1,7 +1,7 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -19,27 +19,15 @@ var AppVersionCmd = &cobra.Command{
 
 func appVersionFunc(cmd *cobra.Command, args []string) error {
 	asJson, err := cmd.Flags().GetBool("json")
-	res, err := rpc.QueryAppVersion()
 	if err != nil {
 		return err
 	}
 
-	if rpc.DryRun {
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryAppVersion(context.Background()))
 	}
 
-	if asJson {
-		fmt.Println(string(res))
-		return nil
-	}
-
-	var appVersion struct {
-		AppVersion           string   `json:"app_version,omitempty"`
-		AppProtocolVersions  []uint64 `json:"app_protocol_versions,omitempty"`
-		StateProtocolVersion uint64   `json:"state_protocol_version,omitempty"`
-		AppProtocolVersion   uint64   `json:"app_protocol_version,omitempty"`
-	}
-	err = json.Unmarshal([]byte(res), &appVersion)
+	appVersion, err := rpc.GetAppVersion(context.Background())
 	if err != nil {
 		return err
 	}
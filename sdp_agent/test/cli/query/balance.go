@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var BalanceCmd = &cobra.Command{
@@ -29,22 +28,11 @@ func balanceFunc(cmd *cobra.Command, args []string) error {
 	}
 
 	// TODO: do some sanity check on client side
-	res, err := rpc.QueryBalance(udc, args[0])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
-	}
-
-	if asJson {
-		fmt.Println(string(res))
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryBalance(context.Background(), udc, args[0]))
 	}
 
-	var balance types.Currency
-	err = json.Unmarshal([]byte(res), &balance)
+	balance, err := rpc.GetBalance(context.Background(), udc, args[0])
 	if err != nil {
 		return err
 	}
@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var DelegateCmd = &cobra.Command{
@@ -23,31 +22,20 @@ func delegateFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := rpc.QueryDelegate(args[0])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryDelegate(context.Background(), args[0]))
 	}
 
-	if asJson {
-		fmt.Println(string(res))
+	delegate, err := rpc.GetDelegate(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no delegate")
 		return nil
 	}
-
-	if res == nil || len(res) == 0 || string(res) == "null" {
-		fmt.Println("no delegate")
-	} else {
-		var delegate types.Delegate
-		err = json.Unmarshal(res, &delegate)
-		if err != nil {
-			return err
-		}
-		fmt.Printf("delegatee address: %s\namount: %s\n",
-			delegate.Delegatee, delegate.Amount.String())
+	if err != nil {
+		return err
 	}
+	fmt.Printf("delegatee address: %s\namount: %s\n",
+		delegate.Delegatee, delegate.Amount.String())
 
 	return nil
 }
\ No newline at end of file
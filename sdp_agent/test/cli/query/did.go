@@ -0,0 +1,68 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/did"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+var DIDCmd = &cobra.Command{
+	Use:   "did <did>",
+	Short: "DID document",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  didFunc,
+}
+
+func didFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryDID(context.Background(), args[0]))
+	}
+
+	doc, err := did.Resolve(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no did")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("id: %s\n", doc.ID)
+	for _, c := range doc.Controller {
+		fmt.Printf("controller: %s\n", c)
+	}
+	for i := range doc.VerificationMethod {
+		printMethod("verification method", &doc.VerificationMethod[i])
+	}
+	auth, err := doc.Methods(doc.Authentication)
+	if err != nil {
+		return err
+	}
+	for _, vm := range auth {
+		printMethod("authentication", vm)
+	}
+	for _, s := range doc.Service {
+		fmt.Printf("service: %s %v %s\n", s.ID, []string(s.Type), s.ServiceEndpoint)
+	}
+
+	return nil
+}
+
+func printMethod(rel string, vm *did.VerificationMethod) {
+	fmt.Printf("%s: %s (%s)\n", rel, vm.ID, vm.Type)
+	address, err := vm.Address()
+	if err != nil {
+		fmt.Printf("  - key: %s\n", err)
+		return
+	}
+	fmt.Printf("  - address: %s\n", address)
+}
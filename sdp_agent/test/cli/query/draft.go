@@ -0,0 +1,241 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+var DraftCmd = &cobra.Command{
+	Use:   "draft <draftID>",
+	Short: "Governance draft detail",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  draftFunc,
+}
+
+var draftListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Drafts still open for voting",
+	Args:  cobra.NoArgs,
+	RunE:  draftListFunc,
+}
+
+func draftFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	voter, err := cmd.Flags().GetString("voter")
+	if err != nil {
+		return err
+	}
+
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryDraft(context.Background(), args[0]))
+	}
+
+	ctx := context.Background()
+	draft, err := rpc.GetDraft(ctx, args[0])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no draft")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("proposer: %s\n", draft.Proposer)
+	fmt.Printf("desc: %s\n", draft.Desc)
+	fmt.Printf("deposit: %s\n", draft.Deposit.String())
+	fmt.Printf("status: %s\n", draftStatus(draft.Draft))
+	fmt.Printf("tally: approve %s, reject %s, quorum %s\n",
+		draft.TallyApprove.String(), draft.TallyReject.String(),
+		draft.TallyQuorum.String())
+
+	// a missing current config only costs us the old values
+	current, err := rpc.GetAppConfig(ctx)
+	if err != nil {
+		current = nil
+	}
+	changes, err := configChanges(current, draft.Config)
+	if err != nil {
+		return err
+	}
+	fmt.Println("config changes:")
+	if len(changes) == 0 {
+		fmt.Println("  none")
+	}
+	for _, c := range changes {
+		fmt.Println("  -", c)
+	}
+
+	for i, v := range draft.Votes {
+		fmt.Printf("  vote %2d. %s: %s\n", i+1, v.Voter, voteString(v.Vote))
+	}
+
+	if len(voter) > 0 {
+		vote, err := rpc.GetVote(ctx, args[0], voter)
+		if err == rpc.ErrNotFound {
+			fmt.Println("your vote: none")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("your vote:", voteString(vote))
+	}
+
+	return nil
+}
+
+// draftStatus describes where a draft is in its life. The counts are blocks
+// left until voting opens, closes and the draft is applied, in that order.
+func draftStatus(d *types.Draft) string {
+	switch {
+	case d.OpenCount > 0:
+		return fmt.Sprintf("voting opens in %d blocks", d.OpenCount)
+	case d.CloseCount > 0:
+		return fmt.Sprintf("voting, closes in %d blocks", d.CloseCount)
+	case d.ApplyCount > 0:
+		return fmt.Sprintf("closed, applied in %d blocks", d.ApplyCount)
+	}
+	return "closed"
+}
+
+func isDraftOpen(d *types.DraftEx) bool {
+	return d.OpenCount > 0 || d.CloseCount > 0
+}
+
+func voteString(v *types.Vote) string {
+	if v == nil {
+		return "none"
+	}
+	if v.Approve {
+		return "approve"
+	}
+	return "reject"
+}
+
+// configChanges lists the settings in proposed that differ from current, as
+// "key: old -> new". With no current config, every proposed setting is
+// listed.
+func configChanges(current *types.AMOAppConfig, proposed types.AMOAppConfig) ([]string, error) {
+	newConf, err := toFields(proposed)
+	if err != nil {
+		return nil, err
+	}
+	oldConf := map[string]json.RawMessage{}
+	if current != nil {
+		oldConf, err = toFields(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []string
+	for key, value := range newConf {
+		old, ok := oldConf[key]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s: %s", key, value))
+		case string(old) != string(value):
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, old, value))
+		}
+	}
+	sort.Strings(changes)
+
+	return changes, nil
+}
+
+func toFields(v interface{}) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func draftListFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	from, err := cmd.Flags().GetUint32("from")
+	if err != nil {
+		return err
+	}
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit < 1 {
+		return errors.New("--limit must be at least 1")
+	}
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+
+	if rpc.DryRun {
+		return printRaw(rpc.QueryDraft(context.Background(), fmt.Sprint(from)))
+	}
+
+	keep := isDraftOpen
+	if all {
+		keep = nil
+	}
+	drafts, next, err := rpc.GetDrafts(context.Background(), from, limit, keep)
+	if err != nil {
+		return err
+	}
+
+	if asJson {
+		type item struct {
+			ID    uint32         `json:"id"`
+			Draft *types.DraftEx `json:"draft"`
+		}
+		items := make([]item, 0, len(drafts))
+		for _, d := range drafts {
+			items = append(items, item{d.ID, d.Draft})
+		}
+		b, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	if len(drafts) == 0 {
+		fmt.Println("no draft")
+	}
+	for _, d := range drafts {
+		fmt.Printf("%4d. %s, proposer: %s, desc: %s\n",
+			d.ID, draftStatus(d.Draft.Draft), d.Draft.Proposer, d.Draft.Desc)
+	}
+	if next != 0 {
+		fmt.Printf("more drafts: --from %d\n", next)
+	}
+
+	return nil
+}
+
+func init() {
+	DraftCmd.Flags().String("voter", "", "show the vote of this address")
+	draftListCmd.Flags().Uint32("from", 1, "first draft id to look at")
+	draftListCmd.Flags().Int("limit", 20, "drafts per page")
+	draftListCmd.Flags().Bool("all", false, "include closed drafts")
+	DraftCmd.AddCommand(draftListCmd)
+}
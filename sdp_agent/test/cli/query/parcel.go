@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var ParcelCmd = &cobra.Command{
@@ -23,27 +22,15 @@ func parcelFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := rpc.QueryParcel(args[0])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryParcel(context.Background(), args[0]))
 	}
 
-	if asJson {
-		fmt.Println(string(res))
-		return nil
-	}
-
-	if res == nil || len(res) == 0 || string(res) == "null" {
+	parcel, err := rpc.GetParcel(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
 		fmt.Println("no parcel")
 		return nil
 	}
-
-	var parcel types.ParcelEx
-	err = json.Unmarshal(res, &parcel)
 	if err != nil {
 		return err
 	}
@@ -1,15 +1,39 @@
 package query
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/cli/util"
+	"github.com/amolabs/amo-client-go/lib/rpc"
 )
 
 var Cmd = &cobra.Command{
 	Use:     "query",
 	Aliases: []string{"q"},
 	Short:   "Query AMO blockchain data",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil || !verify {
+			return err
+		}
+		trustPath, err := cmd.Flags().GetString("trust")
+		if err != nil {
+			return err
+		}
+		if len(trustPath) == 0 {
+			return errors.New("--verify needs a genesis file given by --trust")
+		}
+		rpc.Trust, err = rpc.LoadTrust(trustPath)
+		if err != nil {
+			return err
+		}
+		rpc.Verify = true
+
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := cmd.Help(); err != nil {
 			return err
@@ -20,6 +44,11 @@ var Cmd = &cobra.Command{
 }
 
 func init() {
+	Cmd.PersistentFlags().Bool("verify", false,
+		"verify query results with merkle proofs")
+	Cmd.PersistentFlags().String("trust", "",
+		"genesis file holding the trusted validator set for --verify; "+
+			"it stops verifying once a third of the voting power has changed since")
 	Cmd.AddCommand(
 		StatusCmd,
 		AppVersionCmd,
@@ -32,14 +61,27 @@ func init() {
 		StakeCmd,
 		DelegateCmd,
 		util.LineBreak,
-		DraftCmd, //To-DO
-		VoteCmd, //To-DO
+		DraftCmd,
+		VoteCmd,
 		util.LineBreak,
 		StorageCmd,
 		util.LineBreak,
 		ParcelCmd,
-		RequestCmd, //To-DO
-		UsageCmd, //Remove
+		RequestCmd,
+		UsageCmd,
 		util.LineBreak,
+		DIDCmd,
 	)
 }
+
+// printRaw prints a raw query result as is, for --json. Nothing is printed
+// on a dry run.
+func printRaw(res []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	if !rpc.DryRun {
+		fmt.Println(string(res))
+	}
+	return nil
+}
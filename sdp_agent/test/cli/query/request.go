@@ -0,0 +1,45 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+var RequestCmd = &cobra.Command{
+	Use:   "request <parcelID> <recipient>",
+	Short: "Pending request for a data parcel",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  requestFunc,
+}
+
+func requestFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryRequest(context.Background(), args[0], args[1]))
+	}
+
+	request, err := rpc.GetRequest(context.Background(), args[0], args[1])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no request")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("agency: %s\n", request.Agency)
+	fmt.Printf("payment: %s\n", request.Payment.String())
+	fmt.Printf("dealer: %s\n", request.Dealer)
+	fmt.Printf("dealer_fee: %s\n", request.DealerFee.String())
+	fmt.Printf("extra: %s\n", request.Extra)
+
+	return nil
+}
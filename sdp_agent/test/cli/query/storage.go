@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var StorageCmd = &cobra.Command{
@@ -23,27 +22,15 @@ func storageFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := rpc.QueryStorage(args[0])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryStorage(context.Background(), args[0]))
 	}
 
-	if asJson {
-		fmt.Println(string(res))
-		return nil
-	}
-
-	if res == nil || len(res) == 0 || string(res) == "null" {
+	storage, err := rpc.GetStorage(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
 		fmt.Println("no storage")
 		return nil
 	}
-
-	var storage types.Storage
-	err = json.Unmarshal(res, &storage)
 	if err != nil {
 		return err
 	}
@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var UdcCmd = &cobra.Command{
@@ -23,26 +22,15 @@ func udcFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := rpc.QueryUDC(args[0])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
-	}
-
-	if asJson {
-		fmt.Println(string(res))
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryUDC(context.Background(), args[0]))
 	}
 
-	if res == nil || len(res) == 0 || string(res) == "null" {
+	udc, err := rpc.GetUDC(context.Background(), args[0])
+	if err == rpc.ErrNotFound {
 		fmt.Println("no udc")
 		return nil
 	}
-	var udc types.UDC
-	err = json.Unmarshal(res, &udc)
 	if err != nil {
 		return err
 	}
@@ -1,13 +1,12 @@
 package query
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
 	"github.com/amolabs/amo-client-go/lib/rpc"
-	"github.com/amolabs/amo-client-go/lib/types"
 )
 
 var UdcLockCmd = &cobra.Command{
@@ -23,22 +22,15 @@ func udcLockFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := rpc.QueryUDCLock(args[0], args[1])
-	if err != nil {
-		return err
-	}
-
-	if rpc.DryRun {
-		return nil
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryUDCLock(context.Background(), args[0], args[1]))
 	}
 
-	if asJson {
-		fmt.Println(string(res))
+	amount, err := rpc.GetUDCLock(context.Background(), args[0], args[1])
+	if err == rpc.ErrNotFound {
+		fmt.Println("0")
 		return nil
 	}
-
-	var amount types.Currency
-	err = json.Unmarshal(res, &amount)
 	if err != nil {
 		return err
 	}
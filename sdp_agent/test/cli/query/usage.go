@@ -0,0 +1,42 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+var UsageCmd = &cobra.Command{
+	Use:   "usage <parcelID> <recipient>",
+	Short: "Granted usage of a data parcel",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  usageFunc,
+}
+
+func usageFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryUsage(context.Background(), args[0], args[1]))
+	}
+
+	usage, err := rpc.GetUsage(context.Background(), args[0], args[1])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no usage")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("custody: %s\n", usage.Custody)
+	fmt.Printf("extra: %s\n", usage.Extra)
+
+	return nil
+}
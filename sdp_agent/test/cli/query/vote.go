@@ -0,0 +1,40 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+var VoteCmd = &cobra.Command{
+	Use:   "vote <draftID> <address>",
+	Short: "Vote of an account on a draft",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  voteFunc,
+}
+
+func voteFunc(cmd *cobra.Command, args []string) error {
+	asJson, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	if asJson || rpc.DryRun {
+		return printRaw(rpc.QueryVote(context.Background(), args[0], args[1]))
+	}
+
+	vote, err := rpc.GetVote(context.Background(), args[0], args[1])
+	if err == rpc.ErrNotFound {
+		fmt.Println("no vote")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("draft %s, voter %s: %s\n", args[0], args[1], voteString(vote))
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var BroadcastCmd = &cobra.Command{
+	Use:   "broadcast <file>",
+	Short: "Broadcast a signed transaction",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  broadcastFunc,
+}
+
+func broadcastFunc(cmd *cobra.Command, args []string) error {
+	t, err := readTx(args[0])
+	if err != nil {
+		return err
+	}
+
+	return broadcast(cmd, t)
+}
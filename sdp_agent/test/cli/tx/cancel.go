@@ -0,0 +1,22 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var CancelCmd = &cobra.Command{
+	Use:   "cancel <parcelID>",
+	Short: "Withdraw a request for a parcel",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTx(buildCancel),
+}
+
+func buildCancel(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	return tx.NewCancel(args[0])
+}
+
+func init() {
+	addGenerateCmd(CancelCmd, buildCancel)
+}
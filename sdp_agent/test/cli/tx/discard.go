@@ -0,0 +1,22 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var DiscardCmd = &cobra.Command{
+	Use:   "discard <parcelID>",
+	Short: "Withdraw a registered parcel",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTx(buildDiscard),
+}
+
+func buildDiscard(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	return tx.NewDiscard(args[0])
+}
+
+func init() {
+	addGenerateCmd(DiscardCmd, buildDiscard)
+}
@@ -0,0 +1,93 @@
+package tx
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Write out an unsigned transaction to be signed offline",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cmd.Help(); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+// addGenerateCmd adds to GenerateCmd a copy of c which writes out the
+// transaction c would sign and broadcast.
+func addGenerateCmd(c *cobra.Command, build func(*cobra.Command, []string) (*tx.Tx, error)) {
+	g := &cobra.Command{
+		Use:   c.Use,
+		Short: c.Short,
+		Args:  c.Args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// without a node there is no height to fill in, and a
+			// transaction with a made-up one would look ready to sign
+			if rpc.DryRun {
+				return errors.New("Cannot generate a transaction in a dry run: no last height to fill in")
+			}
+			t, err := build(cmd, args)
+			if err != nil {
+				return err
+			}
+			t.Sender, err = getSender(cmd)
+			if err != nil {
+				return err
+			}
+			err = prepare(cmd, t)
+			if err != nil {
+				return err
+			}
+			return writeTx(cmd, t)
+		},
+	}
+	g.Flags().AddFlagSet(c.Flags())
+	GenerateCmd.AddCommand(g)
+}
+
+// getSender takes the sender from --sender, or the address of the key given
+// by --user, which need not be unlocked.
+func getSender(cmd *cobra.Command) (string, error) {
+	sender, err := cmd.Flags().GetString("sender")
+	if err != nil {
+		return "", err
+	}
+	if len(sender) > 0 {
+		return strings.ToUpper(sender), nil
+	}
+	username, err := cmd.Flags().GetString("user")
+	if err != nil {
+		return "", err
+	}
+	if len(username) == 0 {
+		return "", errors.New("No sender given by --sender or --user")
+	}
+	path, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		return "", err
+	}
+	kr, err := keys.GetKeyRing(path)
+	if err != nil {
+		return "", err
+	}
+	key := kr.GetKey(username)
+	if key == nil {
+		return "", errors.New("No key " + username + " in the keyring")
+	}
+	return key.Address, nil
+}
+
+func init() {
+	GenerateCmd.PersistentFlags().String("sender", "", "address of the signer-to-be")
+	GenerateCmd.PersistentFlags().StringP("out", "o", "", "file to write the transaction to")
+}
@@ -0,0 +1,31 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var GrantCmd = &cobra.Command{
+	Use:   "grant <parcelID> <grantee> <custody>",
+	Short: "Grant a requested parcel, collecting the payment",
+	Args:  cobra.MinimumNArgs(3),
+	RunE:  runTx(buildGrant),
+}
+
+func buildGrant(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	custody, err := getCustody(args[2])
+	if err != nil {
+		return nil, err
+	}
+	extra, err := getExtra(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return tx.NewGrant(args[0], args[1], custody, extra)
+}
+
+func init() {
+	GrantCmd.Flags().String("extra", "", "extra info in JSON")
+	addGenerateCmd(GrantCmd, buildGrant)
+}
@@ -0,0 +1,31 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var RegisterCmd = &cobra.Command{
+	Use:   "register <parcelID> <custody>",
+	Short: "Register an uploaded parcel for sale",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runTx(buildRegister),
+}
+
+func buildRegister(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	custody, err := getCustody(args[1])
+	if err != nil {
+		return nil, err
+	}
+	extra, err := getExtra(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return tx.NewRegister(args[0], custody, extra)
+}
+
+func init() {
+	RegisterCmd.Flags().String("extra", "", "extra info in JSON")
+	addGenerateCmd(RegisterCmd, buildRegister)
+}
@@ -0,0 +1,27 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var RequestCmd = &cobra.Command{
+	Use:   "request <parcelID> <payment>",
+	Short: "Ask for a parcel, offering a payment",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runTx(buildRequest),
+}
+
+func buildRequest(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	extra, err := getExtra(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return tx.NewRequest(args[0], args[1], extra)
+}
+
+func init() {
+	RequestCmd.Flags().String("extra", "", "extra info in JSON")
+	addGenerateCmd(RequestCmd, buildRequest)
+}
@@ -0,0 +1,22 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var RevokeCmd = &cobra.Command{
+	Use:   "revoke <parcelID> <grantee>",
+	Short: "Revoke a grant on a parcel",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runTx(buildRevoke),
+}
+
+func buildRevoke(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	return tx.NewRevoke(args[0], args[1])
+}
+
+func init() {
+	addGenerateCmd(RevokeCmd, buildRevoke)
+}
@@ -0,0 +1,39 @@
+package tx
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var SignCmd = &cobra.Command{
+	Use:   "sign <file>",
+	Short: "Sign a generated transaction offline",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  signFunc,
+}
+
+func signFunc(cmd *cobra.Command, args []string) error {
+	t, err := readTx(args[0])
+	if err != nil {
+		return err
+	}
+	key, err := signingKey(cmd)
+	if err != nil {
+		return err
+	}
+	// show what is about to be signed, away from the output
+	fmt.Fprintf(os.Stderr, "signing %s by %s, fee %s, last height %s, nonce %s\n%s\n",
+		t.Type, key.Address, t.Fee, t.LastHeight, t.Nonce, string(t.Payload))
+	err = t.Sign(key)
+	if err != nil {
+		return err
+	}
+
+	return writeTx(cmd, t)
+}
+
+func init() {
+	SignCmd.Flags().StringP("out", "o", "", "file to write the signed transaction to")
+}
@@ -0,0 +1,27 @@
+package tx
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+var TransferCmd = &cobra.Command{
+	Use:   "transfer <address> <amount>",
+	Short: "Transfer coins to an account",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runTx(buildTransfer),
+}
+
+func buildTransfer(cmd *cobra.Command, args []string) (*tx.Tx, error) {
+	udc, err := cmd.Flags().GetUint32("udc")
+	if err != nil {
+		return nil, err
+	}
+	return tx.NewTransfer(udc, args[0], args[1])
+}
+
+func init() {
+	TransferCmd.Flags().Uint32("udc", uint32(0), "specify udc id if necessary")
+	addGenerateCmd(TransferCmd, buildTransfer)
+}
@@ -0,0 +1,230 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/amolabs/amo-client-go/cli/util"
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+	"github.com/amolabs/amo-client-go/lib/tx"
+)
+
+// passphraseEnv names the environment variable the passphrase of the signing
+// key is taken from when no --pass-file is given.
+const passphraseEnv = "AMO_PASSPHRASE"
+
+var Cmd = &cobra.Command{
+	Use:   "tx",
+	Short: "Sign and broadcast AMO blockchain transactions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cmd.Help(); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	home, _ := os.UserHomeDir()
+	Cmd.PersistentFlags().String("keyring",
+		filepath.Join(home, ".amocli", "keys", "keys.json"), "keyring file")
+	Cmd.PersistentFlags().StringP("user", "u", "", "username of the signing key")
+	Cmd.PersistentFlags().String("pass-file", "",
+		"file holding the passphrase of the signing key, instead of $"+passphraseEnv)
+	Cmd.PersistentFlags().String("fee", "0", "fee in mote")
+	Cmd.AddCommand(
+		TransferCmd,
+		util.LineBreak,
+		RegisterCmd,
+		DiscardCmd,
+		RequestCmd,
+		CancelCmd,
+		GrantCmd,
+		RevokeCmd,
+		util.LineBreak,
+		GenerateCmd,
+		SignCmd,
+		BroadcastCmd,
+	)
+}
+
+// signingKey unlocks the key given by --user in the keyring.
+func signingKey(cmd *cobra.Command) (*keys.KeyEntry, error) {
+	path, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		return nil, err
+	}
+	username, err := cmd.Flags().GetString("user")
+	if err != nil {
+		return nil, err
+	}
+	if len(username) == 0 {
+		return nil, errors.New("No signing key given by --user")
+	}
+	passphrase, err := getPassphrase(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range passphrase {
+			passphrase[i] = 0
+		}
+	}()
+	kr, err := keys.GetKeyRing(path)
+	if err != nil {
+		return nil, err
+	}
+	return kr.Unlock(username, passphrase)
+}
+
+// getPassphrase reads the passphrase from --pass-file, or from the
+// environment, so that it does not show up in the process list or the shell
+// history. A trailing line break in the file is not part of it.
+func getPassphrase(cmd *cobra.Command) ([]byte, error) {
+	path, err := cmd.Flags().GetString("pass-file")
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return []byte(os.Getenv(passphraseEnv)), nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b, "\r\n"), nil
+}
+
+func getExtra(cmd *cobra.Command) (json.RawMessage, error) {
+	extra, err := cmd.Flags().GetString("extra")
+	if err != nil || len(extra) == 0 {
+		return nil, err
+	}
+	if !json.Valid([]byte(extra)) {
+		return nil, errors.New("--extra is not JSON")
+	}
+	return json.RawMessage(extra), nil
+}
+
+func getCustody(arg string) ([]byte, error) {
+	custody, err := hex.DecodeString(arg)
+	if err != nil {
+		return nil, errors.New("Custody is not hex: " + err.Error())
+	}
+	return custody, nil
+}
+
+// prepare fills in the fee, a nonce and the height past which the chain
+// refuses the transaction.
+func prepare(cmd *cobra.Command, t *tx.Tx) error {
+	var err error
+	t.Fee, err = cmd.Flags().GetString("fee")
+	if err != nil {
+		return err
+	}
+	err = t.SetNonce()
+	if err != nil {
+		return err
+	}
+	height, err := rpc.LastHeight(context.Background())
+	if err != nil {
+		return err
+	}
+	t.SetLastHeight(height)
+
+	return nil
+}
+
+// runTx makes a command that builds a transaction, signs it with the key
+// given by --user and broadcasts it.
+func runTx(build func(*cobra.Command, []string) (*tx.Tx, error)) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		t, err := build(cmd, args)
+		if err != nil {
+			return err
+		}
+		key, err := signingKey(cmd)
+		if err != nil {
+			return err
+		}
+		err = prepare(cmd, t)
+		if err != nil {
+			return err
+		}
+		err = t.Sign(key)
+		if err != nil {
+			return err
+		}
+		return broadcast(cmd, t)
+	}
+}
+
+// broadcast waits for the transaction to be committed, or for the user to
+// give up with an interrupt.
+func broadcast(cmd *cobra.Command, t *tx.Tx) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	res, err := t.Broadcast(ctx)
+	if err != nil {
+		return err
+	}
+	if rpc.DryRun {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+
+	return nil
+}
+
+// readTx reads a transaction from a file, or from stdin if the file is "-".
+func readTx(path string) (*tx.Tx, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tx.Decode(b)
+}
+
+// writeTx writes a transaction as indented JSON to --out, or to stdout.
+func writeTx(cmd *cobra.Command, t *tx.Tx) error {
+	out, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if len(out) == 0 {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(out, b, 0644)
+}
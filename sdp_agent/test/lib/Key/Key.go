@@ -11,17 +11,47 @@ import (
 	"strings"
 
 	"github.com/tendermint/tendermint/crypto/xsalsa20symmetric"
+	"golang.org/x/crypto/scrypt"
 )
 
 var (
 	c = elliptic.P256()
+
+	// DefaultKDFParams is the cost used when encrypting new keys. Tune it
+	// down on slow field units; the cost is stored with every key.
+	DefaultKDFParams = KDFParams{N: 1 << 15, R: 8, P: 1}
+)
+
+// Versions of the private key encryption format
+const (
+	// xsalsa20 keyed with sha256(passphrase); read only
+	KeyVersionLegacy = 0
+	// xsalsa20 keyed with scrypt(passphrase, salt)
+	KeyVersionScrypt = 1
+
+	saltSize = 16
+	// upper bounds on the scrypt cost so that a crafted keyring cannot hog
+	// the memory, which scrypt takes 128*N*R bytes of, or the CPU
+	maxScryptN   = 1 << 22
+	maxScryptR   = 32
+	maxScryptP   = 16
+	maxScryptMem = 1 << 30
 )
 
+type KDFParams struct {
+	Salt []byte `json:"salt,omitempty"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
 type KeyEntry struct {
-	Address   string `json:"address"`
-	PubKey    []byte `json:"pub_key"`
-	PrivKey   []byte `json:"priv_key"`
-	Encrypted bool   `json:"encrypted"`
+	Address   string     `json:"address"`
+	PubKey    []byte     `json:"pub_key"`
+	PrivKey   []byte     `json:"priv_key"`
+	Encrypted bool       `json:"encrypted"`
+	Version   int        `json:"version,omitempty"`
+	KDF       *KDFParams `json:"kdf,omitempty"`
 }
 
 func generateECDSAKey(seed string) (privKey *ecdsa.PrivateKey, err error) {
@@ -68,37 +98,102 @@ func fillInt(b []byte, l int, i *big.Int) {
 	}
 }
 
-func toKeyEntry(privKey *ecdsa.PrivateKey, pw []byte, encrypt bool) *KeyEntry {
+func checkKDFParams(params *KDFParams) error {
+	if params.N <= 1 || params.R <= 0 || params.P <= 0 {
+		return errors.New("Malformed KDF parameters")
+	}
+	if params.N > maxScryptN || params.R > maxScryptR || params.P > maxScryptP ||
+		128*int64(params.N)*int64(params.R) > maxScryptMem {
+		return errors.New("KDF cost too high")
+	}
+	return nil
+}
+
+func deriveKey(passphrase []byte, version int, params *KDFParams) ([]byte, error) {
+	switch version {
+	case KeyVersionLegacy:
+		encKey := sha256.Sum256(passphrase)
+		return encKey[:], nil
+	case KeyVersionScrypt:
+		if params == nil || len(params.Salt) == 0 {
+			return nil, errors.New("Missing KDF parameters")
+		}
+		err := checkKDFParams(params)
+		if err != nil {
+			return nil, err
+		}
+		return scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, 32)
+	default:
+		return nil, errors.New("Unknown key encryption version")
+	}
+}
+
+// encrypt seals the plain private key with the passphrase using the current
+// format and DefaultKDFParams.
+func (key *KeyEntry) encrypt(passphrase []byte) error {
+	if key.Encrypted {
+		return errors.New("The key is already encrypted")
+	}
+	params := DefaultKDFParams
+	params.Salt = make([]byte, saltSize)
+	_, err := rand.Read(params.Salt)
+	if err != nil {
+		return err
+	}
+	encKey, err := deriveKey(passphrase, KeyVersionScrypt, &params)
+	if err != nil {
+		return err
+	}
+
+	key.PrivKey = xsalsa20symmetric.EncryptSymmetric(key.PrivKey, encKey)
+	key.Encrypted = true
+	key.Version = KeyVersionScrypt
+	key.KDF = &params
+
+	return nil
+}
+
+func toKeyEntry(privKey *ecdsa.PrivateKey) *KeyEntry {
 	key := new(KeyEntry)
 	b := make([]byte, 32)
 	fillInt(b, 32, privKey.D)
-	if encrypt {
-		encKey := sha256.Sum256(pw)
-		key.PrivKey = xsalsa20symmetric.EncryptSymmetric(b, encKey[:])
-	} else {
-		key.PrivKey = b
-	}
-	key.Encrypted = encrypt
+	key.PrivKey = b
 	// encode to uncompressed form of a public key
 	b = make([]byte, 65)
 	b[0] = 0x04
 	fillInt(b[1:], 32, privKey.PublicKey.X)
 	fillInt(b[33:], 32, privKey.PublicKey.Y)
 	key.PubKey = b
-	// hash it to derive address
-	hash := sha256.Sum256(b)
-	key.Address = strings.ToUpper(hex.EncodeToString(hash[:20]))
+	key.Address = DeriveAddress(b)
 
 	return key
 }
 
+// DeriveAddress hashes a public key into its account address.
+func DeriveAddress(pubKey []byte) string {
+	hash := sha256.Sum256(pubKey)
+	return strings.ToUpper(hex.EncodeToString(hash[:20]))
+}
+
+func newKeyEntry(privKey *ecdsa.PrivateKey, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	key := toKeyEntry(privKey)
+	if encrypt {
+		err := key.encrypt(passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
 func GenerateKey(seed string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
 	privKey, err := generateECDSAKey(seed)
 	if err != nil {
 		return nil, err
 	}
 
-	return toKeyEntry(privKey, passphrase, encrypt), nil
+	return newKeyEntry(privKey, passphrase, encrypt)
 }
 
 func ImportKey(keyBytes []byte, passphrase []byte, encrypt bool) (*KeyEntry, error) {
@@ -107,7 +202,7 @@ func ImportKey(keyBytes []byte, passphrase []byte, encrypt bool) (*KeyEntry, err
 		return nil, err
 	}
 
-	return toKeyEntry(privKey, passphrase, encrypt), nil
+	return newKeyEntry(privKey, passphrase, encrypt)
 }
 
 func (key *KeyEntry) Decrypt(passphrase []byte) error {
@@ -115,14 +210,45 @@ func (key *KeyEntry) Decrypt(passphrase []byte) error {
 		return errors.New("The key is not encrypted")
 	}
 
-	encKey := sha256.Sum256(passphrase)
-	plainKey, err := xsalsa20symmetric.DecryptSymmetric(key.PrivKey, encKey[:])
+	encKey, err := deriveKey(passphrase, key.Version, key.KDF)
+	if err != nil {
+		return err
+	}
+	plainKey, err := xsalsa20symmetric.DecryptSymmetric(key.PrivKey, encKey)
 	if err != nil {
 		return err
 	}
 
 	key.Encrypted = false
 	key.PrivKey = plainKey
+	key.Version = KeyVersionLegacy
+	key.KDF = nil
 
 	return nil
 }
+
+// NeedsUpgrade tells if the key is stored in an outdated encryption format.
+func (key *KeyEntry) NeedsUpgrade() bool {
+	return key.Encrypted && key.Version != KeyVersionScrypt
+}
+
+// Upgrade re-encrypts a key stored in an outdated format with the current
+// one, leaving it encrypted under the same passphrase. It returns false when
+// there was nothing to do.
+func (key *KeyEntry) Upgrade(passphrase []byte) (bool, error) {
+	if !key.NeedsUpgrade() {
+		return false, nil
+	}
+	upgraded := *key
+	err := upgraded.Decrypt(passphrase)
+	if err != nil {
+		return false, err
+	}
+	err = upgraded.encrypt(passphrase)
+	if err != nil {
+		return false, err
+	}
+	*key = upgraded
+
+	return true, nil
+}
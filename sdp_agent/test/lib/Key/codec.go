@@ -0,0 +1,296 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// Key formats understood by the import and export functions
+const (
+	// 32-byte private scalar, or the 65-byte uncompressed public key
+	FormatRaw = "raw"
+	// 33-byte SEC1 compressed public key
+	FormatCompressed = "compressed"
+	// PKCS#8 "PRIVATE KEY" or PKIX "PUBLIC KEY" PEM, as openssl writes them
+	FormatPEM = "pem"
+	// SEC1 "EC PRIVATE KEY" PEM
+	FormatSEC1 = "sec1"
+	// RFC 7517 JSON Web Key
+	FormatJWK = "jwk"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d,omitempty"`
+}
+
+// ToECDSA returns the key for use with crypto/ecdsa and crypto/x509. The key
+// must be decrypted first.
+func (key *KeyEntry) ToECDSA() (*ecdsa.PrivateKey, error) {
+	if key.Encrypted {
+		return nil, errors.New("The key is encrypted")
+	}
+	return setECDSAKey(key.PrivKey)
+}
+
+func ecdsaPubKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: c, X: X, Y: Y}, nil
+}
+
+// FromECDSAPubKey encodes a crypto/ecdsa public key the way KeyEntry.PubKey
+// holds it.
+func FromECDSAPubKey(pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub.Curve != c {
+		return nil, errors.New("Not a P-256 key")
+	}
+	b := make([]byte, pubKeySize)
+	b[0] = 0x04
+	fillInt(b[1:], 32, pub.X)
+	fillInt(b[33:], 32, pub.Y)
+	return b, nil
+}
+
+func b64(i *big.Int) string {
+	b := make([]byte, 32)
+	fillInt(b, 32, i)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func unb64(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("Malformed JWK coordinate")
+	}
+	return b, nil
+}
+
+// CompressPubKey converts a public key to the 33-byte SEC1 compressed form.
+func CompressPubKey(pubKey []byte) ([]byte, error) {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return elliptic.MarshalCompressed(c, X, Y), nil
+}
+
+// DecompressPubKey converts a public key in either SEC1 form to the 65-byte
+// uncompressed form that addresses are derived from.
+func DecompressPubKey(pubKey []byte) ([]byte, error) {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return FromECDSAPubKey(&ecdsa.PublicKey{Curve: c, X: X, Y: Y})
+}
+
+func (key *KeyEntry) ExportPublic(format string) ([]byte, error) {
+	switch format {
+	case FormatRaw:
+		return append([]byte{}, key.PubKey...), nil
+	case FormatCompressed:
+		return CompressPubKey(key.PubKey)
+	case FormatPEM:
+		pub, err := ecdsaPubKey(key.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case FormatJWK:
+		pub, err := ecdsaPubKey(key.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(jwk{Kty: "EC", Crv: "P-256", X: b64(pub.X), Y: b64(pub.Y)})
+	default:
+		return nil, errors.New("Unsupported public key format: " + format)
+	}
+}
+
+// ExportPrivate encodes the private key. The key must be decrypted first.
+func (key *KeyEntry) ExportPrivate(format string) ([]byte, error) {
+	privKey, err := key.ToECDSA()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatRaw:
+		return append([]byte{}, key.PrivKey...), nil
+	case FormatPEM:
+		der, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	case FormatSEC1:
+		der, err := x509.MarshalECPrivateKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	case FormatJWK:
+		return json.Marshal(jwk{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64(privKey.X),
+			Y:   b64(privKey.Y),
+			D:   b64(privKey.D),
+		})
+	default:
+		return nil, errors.New("Unsupported private key format: " + format)
+	}
+}
+
+func decodePEM(data []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	}
+	return block, nil
+}
+
+// ImportPrivate reads a private key in any of the private key formats. PEM
+// input may be either PKCS#8 or SEC1 regardless of which of the two formats
+// is given.
+func ImportPrivate(data []byte, format string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	var keyBytes []byte
+	switch format {
+	case FormatRaw:
+		keyBytes = append([]byte{}, data...)
+	case FormatPEM, FormatSEC1:
+		block, err := decodePEM(data)
+		if err != nil {
+			return nil, err
+		}
+		var privKey *ecdsa.PrivateKey
+		switch block.Type {
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			privKey, ok = parsed.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("Not an EC private key")
+			}
+		case "EC PRIVATE KEY":
+			privKey, err = x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("Unexpected PEM block: " + block.Type)
+		}
+		if privKey.Curve != c {
+			return nil, errors.New("Not a P-256 key")
+		}
+		keyBytes = make([]byte, 32)
+		fillInt(keyBytes, 32, privKey.D)
+	case FormatJWK:
+		var k jwk
+		err := json.Unmarshal(data, &k)
+		if err != nil {
+			return nil, err
+		}
+		if k.Kty != "EC" || k.Crv != "P-256" || len(k.D) == 0 {
+			return nil, errors.New("Not a P-256 private JWK")
+		}
+		keyBytes, err = unb64(k.D)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ImportKey(keyBytes, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		// the public part must belong to d
+		pub, err := parseJWKPublic(k)
+		if err != nil {
+			return nil, err
+		}
+		if string(pub) != string(key.PubKey) {
+			return nil, errors.New("JWK public key does not match d")
+		}
+	default:
+		return nil, errors.New("Unsupported private key format: " + format)
+	}
+
+	d := new(big.Int).SetBytes(keyBytes)
+	if d.Sign() == 0 || d.Cmp(c.Params().N) >= 0 {
+		return nil, errors.New("Invalid private key")
+	}
+	return ImportKey(keyBytes, passphrase, encrypt)
+}
+
+func parseJWKPublic(k jwk) ([]byte, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, errors.New("Not a P-256 JWK")
+	}
+	x, err := unb64(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := unb64(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{0x04}, x...)
+	b = append(b, y...)
+	_, _, err = parsePubKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ImportPublic reads a public key in any of the public key formats and
+// returns it in the uncompressed form used by KeyEntry.PubKey.
+func ImportPublic(data []byte, format string) ([]byte, error) {
+	switch format {
+	case FormatRaw, FormatCompressed:
+		return DecompressPubKey(data)
+	case FormatPEM:
+		block, err := decodePEM(data)
+		if err != nil {
+			return nil, err
+		}
+		if block.Type != "PUBLIC KEY" {
+			return nil, errors.New("Unexpected PEM block: " + block.Type)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := parsed.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("Not an EC public key")
+		}
+		return FromECDSAPubKey(pub)
+	case FormatJWK:
+		var k jwk
+		err := json.Unmarshal(data, &k)
+		if err != nil {
+			return nil, err
+		}
+		return parseJWKPublic(k)
+	default:
+		return nil, errors.New("Unsupported public key format: " + format)
+	}
+}
@@ -0,0 +1,114 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const (
+	pubKeySize     = 65
+	compressedSize = 33
+	nonceSize      = 12
+)
+
+// parsePubKey decodes a P-256 public key in uncompressed form, as produced
+// by toKeyEntry, or in SEC1 compressed form, and checks that the point is on
+// the curve.
+func parsePubKey(b []byte) (*big.Int, *big.Int, error) {
+	if len(b) == compressedSize && (b[0] == 0x02 || b[0] == 0x03) {
+		X, Y := elliptic.UnmarshalCompressed(c, b)
+		if X == nil {
+			return nil, nil, errors.New("Public key is not on the curve")
+		}
+		return X, Y, nil
+	}
+	if len(b) != pubKeySize || b[0] != 0x04 {
+		return nil, nil, errors.New("Wrong public key format")
+	}
+	X := new(big.Int).SetBytes(b[1:33])
+	Y := new(big.Int).SetBytes(b[33:])
+	if !c.IsOnCurve(X, Y) {
+		return nil, nil, errors.New("Public key is not on the curve")
+	}
+	return X, Y, nil
+}
+
+// eciesKey derives the AES-256 key from the ECDH shared secret with the ANSI
+// X9.63 KDF, binding it to the ephemeral public key.
+func eciesKey(sharedX *big.Int, ephPub []byte) []byte {
+	z := make([]byte, 32)
+	fillInt(z, 32, sharedX)
+	h := sha256.New()
+	h.Write(z)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(ephPub)
+	return h.Sum(nil)
+}
+
+// SealTo encrypts msg so that only the holder of the private key for pubKey
+// can read it. The result is the ephemeral public key, the nonce and the
+// AES-GCM ciphertext, in that order.
+func SealTo(pubKey []byte, msg []byte) ([]byte, error) {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	eph, err := generateECDSAKey("")
+	if err != nil {
+		return nil, err
+	}
+	ephKey := toKeyEntry(eph)
+	ephPub := ephKey.PubKey
+	sharedX, _ := c.ScalarMult(X, Y, ephKey.PrivKey)
+
+	block, err := aes.NewCipher(eciesKey(sharedX, ephPub))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append(ephPub, nonce...)
+	return aead.Seal(out, nonce, msg, nil), nil
+}
+
+// Open decrypts a message produced by SealTo for this key. The key must not
+// be passphrase-encrypted.
+func (key *KeyEntry) Open(sealed []byte) ([]byte, error) {
+	if key.Encrypted {
+		return nil, errors.New("The key is encrypted")
+	}
+	if len(sealed) < pubKeySize+nonceSize {
+		return nil, errors.New("Sealed message too short")
+	}
+	ephPub := sealed[:pubKeySize]
+	nonce := sealed[pubKeySize : pubKeySize+nonceSize]
+	X, Y, err := parsePubKey(ephPub)
+	if err != nil {
+		return nil, err
+	}
+	sharedX, _ := c.ScalarMult(X, Y, key.PrivKey)
+
+	block, err := aes.NewCipher(eciesKey(sharedX, ephPub))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, nonce, sealed[pubKeySize+nonceSize:], nil)
+}
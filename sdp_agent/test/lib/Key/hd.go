@@ -0,0 +1,151 @@
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// HD derivation follows SLIP-0010 for the NIST P-256 curve. Only hardened
+// children are supported: every path component is hardened whether or not it
+// is written with a trailing ' or h, so a leaked unit key reveals nothing
+// about its siblings or the master.
+const (
+	hardenedOffset = uint32(0x80000000)
+	hdMasterSecret = "Nist256p1 seed"
+)
+
+type HDKey struct {
+	Key       []byte
+	ChainCode []byte
+}
+
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("Seed must be 16 to 64 bytes long")
+	}
+	I := hmacSHA512([]byte(hdMasterSecret), seed)
+	for {
+		d := new(big.Int).SetBytes(I[:32])
+		if d.Sign() != 0 && d.Cmp(c.Params().N) < 0 {
+			break
+		}
+		I = hmacSHA512([]byte(hdMasterSecret), I)
+	}
+
+	return &HDKey{Key: I[:32], ChainCode: I[32:]}, nil
+}
+
+// NewMasterKeyFromMnemonic derives the master key from a BIP-39 phrase, so
+// that a single phrase backs up every key of a fleet.
+func NewMasterKeyFromMnemonic(mnemonic string, password string) (*HDKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(
+		strings.Join(strings.Fields(strings.ToLower(mnemonic)), " "), password)
+	if err != nil {
+		return nil, errors.New("Invalid mnemonic: wrong word or checksum")
+	}
+	return NewMasterKey(seed)
+}
+
+// GenerateMasterMnemonic returns a fresh 24-word phrase for a fleet master.
+func GenerateMasterMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Child derives the hardened child i of the key.
+func (k *HDKey) Child(i uint32) (*HDKey, error) {
+	if i >= hardenedOffset {
+		i -= hardenedOffset
+	}
+	n := c.Params().N
+	parent := new(big.Int).SetBytes(k.Key)
+	data := make([]byte, 37)
+	copy(data[1:33], k.Key)
+	binary.BigEndian.PutUint32(data[33:], i+hardenedOffset)
+	for {
+		I := hmacSHA512(k.ChainCode, data)
+		IL := new(big.Int).SetBytes(I[:32])
+		if IL.Cmp(n) < 0 {
+			child := IL.Add(IL, parent)
+			child.Mod(child, n)
+			if child.Sign() != 0 {
+				key := make([]byte, 32)
+				fillInt(key, 32, child)
+				return &HDKey{Key: key, ChainCode: I[32:]}, nil
+			}
+		}
+		data[0] = 0x01
+		copy(data[1:33], I[32:])
+	}
+}
+
+// ParseHDPath parses a path such as "m/3/17/0" or "3'/17'/0'".
+func ParseHDPath(path string) ([]uint32, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "m"), "/")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	var indices []uint32
+	for _, s := range strings.Split(path, "/") {
+		s = strings.TrimRight(s, "'hH")
+		i, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || uint32(i) >= hardenedOffset {
+			return nil, errors.New("Invalid path component: " + s)
+		}
+		indices = append(indices, uint32(i))
+	}
+	return indices, nil
+}
+
+// FleetPath is the path of a unit key in a corridor.
+func FleetPath(corridor, unit, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'", corridor, unit, index)
+}
+
+func (k *HDKey) Derive(path string) (*HDKey, error) {
+	indices, err := ParseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+	key := k
+	for _, i := range indices {
+		key, err = key.Child(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// KeyEntry turns the derived key into an ordinary account key.
+func (k *HDKey) KeyEntry(passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	return ImportKey(k.Key, passphrase, encrypt)
+}
+
+// DeriveKey derives the key at path from the master and returns it as an
+// account key.
+func DeriveKey(master *HDKey, path string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	child, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return child.KeyEntry(passphrase, encrypt)
+}
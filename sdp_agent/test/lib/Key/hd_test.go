@@ -0,0 +1,63 @@
+package keys
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SLIP-0010 test vector 1 for nist256p1
+func TestHDVector(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	assert.NoError(t, err)
+	assert.Equal(t, "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", hex.EncodeToString(master.Key))
+	assert.Equal(t, "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", hex.EncodeToString(master.ChainCode))
+
+	child, err := master.Derive("m/0'")
+	assert.NoError(t, err)
+	assert.Equal(t, "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c", hex.EncodeToString(child.Key))
+	assert.Equal(t, "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", hex.EncodeToString(child.ChainCode))
+}
+
+func TestHDFleet(t *testing.T) {
+	mnemonic, err := GenerateMasterMnemonic()
+	assert.NoError(t, err)
+	master, err := NewMasterKeyFromMnemonic(mnemonic, "")
+	assert.NoError(t, err)
+
+	key, err := DeriveKey(master, FleetPath(3, 17, 0), nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, len(key.Address))
+	assert.Equal(t, 65, len(key.PubKey))
+
+	// same master backup regenerates the same unit
+	master2, err := NewMasterKeyFromMnemonic(mnemonic, "")
+	assert.NoError(t, err)
+	key2, err := DeriveKey(master2, "3h/17h/0h", []byte("pass"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Address, key2.Address)
+	imported, err := ImportKey(key.PrivKey, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, key, imported)
+
+	// siblings and other passwords differ
+	other, err := DeriveKey(master, FleetPath(3, 17, 1), nil, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.Address, other.Address)
+	master3, err := NewMasterKeyFromMnemonic(mnemonic, "other")
+	assert.NoError(t, err)
+	other, err = DeriveKey(master3, FleetPath(3, 17, 0), nil, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.Address, other.Address)
+
+	for _, path := range []string{"m/x", "m/1//2", "m/2147483648", "m/-1"} {
+		_, err = master.Derive(path)
+		assert.Error(t, err, path)
+	}
+	_, err = NewMasterKey([]byte("short"))
+	assert.Error(t, err)
+	_, err = NewMasterKeyFromMnemonic("not a mnemonic", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/xsalsa20symmetric"
+)
+
+func legacyEncrypt(privKey, passphrase []byte) []byte {
+	encKey := sha256.Sum256(passphrase)
+	return xsalsa20symmetric.EncryptSymmetric(privKey, encKey[:])
+}
+
+func TestKeyEncryption(t *testing.T) {
+	plain, err := GenerateKey("test", nil, false)
+	assert.NoError(t, err)
+	assert.Nil(t, plain.KDF)
+
+	key, err := GenerateKey("test", []byte("pass"), true)
+	assert.NoError(t, err)
+	assert.True(t, key.Encrypted)
+	assert.Equal(t, KeyVersionScrypt, key.Version)
+	assert.NotNil(t, key.KDF)
+	assert.Equal(t, saltSize, len(key.KDF.Salt))
+	assert.Equal(t, DefaultKDFParams.N, key.KDF.N)
+	assert.False(t, key.NeedsUpgrade())
+	assert.Equal(t, plain.Address, key.Address)
+
+	// salt is per key
+	key2, err := GenerateKey("test", []byte("pass"), true)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.KDF.Salt, key2.KDF.Salt)
+	assert.NotEqual(t, key.PrivKey, key2.PrivKey)
+
+	// parameters survive a round trip through the keyring format
+	b, err := json.Marshal(key)
+	assert.NoError(t, err)
+	var loaded KeyEntry
+	assert.NoError(t, json.Unmarshal(b, &loaded))
+	assert.Equal(t, *key, loaded)
+
+	assert.Error(t, loaded.Decrypt([]byte("wrong")))
+	assert.True(t, loaded.Encrypted)
+	assert.NoError(t, loaded.Decrypt([]byte("pass")))
+	assert.Equal(t, *plain, loaded)
+	assert.Error(t, loaded.Decrypt([]byte("pass")))
+
+	// refuse absurd costs from a tampered file
+	key.KDF.N = 1 << 30
+	assert.Error(t, key.Decrypt([]byte("pass")))
+	for _, kdf := range []KDFParams{
+		{N: 1 << 22, R: 8, P: 1},
+		{N: 1 << 15, R: 1 << 20, P: 1},
+		{N: 1 << 15, R: 8, P: 1 << 20},
+		{N: 1 << 15, R: 0, P: 1},
+		{N: 1 << 15, R: 8, P: -1},
+		{N: 0, R: 8, P: 1},
+	} {
+		kdf.Salt = key.KDF.Salt
+		key.KDF = &kdf
+		assert.Error(t, key.Decrypt([]byte("pass")), kdf)
+	}
+}
+
+func TestKeyUpgrade(t *testing.T) {
+	plain, err := GenerateKey("test", nil, false)
+	assert.NoError(t, err)
+
+	// entry as written by older clients
+	legacy := *plain
+	legacy.PrivKey = legacyEncrypt(plain.PrivKey, []byte("pass"))
+	legacy.Encrypted = true
+	assert.True(t, legacy.NeedsUpgrade())
+
+	b, err := json.Marshal(legacy)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "kdf")
+
+	old := legacy
+	upgraded, err := old.Upgrade([]byte("wrong"))
+	assert.Error(t, err)
+	assert.False(t, upgraded)
+	assert.Equal(t, legacy, old)
+
+	upgraded, err = old.Upgrade([]byte("pass"))
+	assert.NoError(t, err)
+	assert.True(t, upgraded)
+	assert.True(t, old.Encrypted)
+	assert.Equal(t, KeyVersionScrypt, old.Version)
+	assert.False(t, old.NeedsUpgrade())
+
+	upgraded, err = old.Upgrade([]byte("pass"))
+	assert.NoError(t, err)
+	assert.False(t, upgraded)
+
+	assert.NoError(t, old.Decrypt([]byte("pass")))
+	assert.Equal(t, *plain, old)
+
+	// legacy entries still decrypt directly
+	assert.NoError(t, legacy.Decrypt([]byte("pass")))
+	assert.Equal(t, *plain, legacy)
+}
+
+func TestMnemonic(t *testing.T) {
+	key, err := GenerateKey("", nil, false)
+	assert.NoError(t, err)
+	mnemonic, err := key.Mnemonic()
+	assert.NoError(t, err)
+	words := strings.Fields(mnemonic)
+	assert.Equal(t, 24, len(words))
+
+	restored, err := ImportMnemonic(mnemonic, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, key, restored)
+
+	// whitespace and case do not matter
+	restored, err = ImportMnemonic("  "+strings.ToUpper(strings.Join(words, "\n  "))+"\n", []byte("pass"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Address, restored.Address)
+	assert.True(t, restored.Encrypted)
+
+	// swapped words break the checksum
+	swapped := append([]string{}, words...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if swapped[0] != swapped[1] {
+		_, err = ImportMnemonic(strings.Join(swapped, " "), nil, false)
+		assert.Error(t, err)
+	}
+	_, err = ImportMnemonic(strings.Join(words[:12], " "), nil, false)
+	assert.Error(t, err)
+	_, err = ImportMnemonic(strings.Join(append(words[:23], "notaword"), " "), nil, false)
+	assert.Error(t, err)
+
+	enc, err := GenerateKey("", []byte("pass"), true)
+	assert.NoError(t, err)
+	_, err = enc.Mnemonic()
+	assert.Error(t, err)
+}
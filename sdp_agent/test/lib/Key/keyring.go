@@ -0,0 +1,345 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyRing is a set of named keys persisted in a single JSON file. Every
+// change re-reads the file under an exclusive lock before writing it back, so
+// several processes may share one keyring. The file is replaced atomically
+// and the previous version is kept next to it as a backup.
+type KeyRing struct {
+	filePath string
+	mtx      sync.Mutex
+	keyList  map[string]KeyEntry // just a cache
+}
+
+func GetKeyRing(path string) (*KeyRing, error) {
+	kr := &KeyRing{
+		filePath: path,
+		keyList:  make(map[string]KeyEntry),
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = kr.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return kr, nil
+}
+
+func (kr *KeyRing) backupPath() string {
+	return kr.filePath + ".bak"
+}
+
+func (kr *KeyRing) lockPath() string {
+	return kr.filePath + ".lock"
+}
+
+// withLock runs fn while holding the keyring file lock.
+func (kr *KeyRing) withLock(exclusive bool, fn func() error) error {
+	lock, err := lockFile(kr.lockPath(), exclusive)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	return fn()
+}
+
+func readKeyList(path string) (map[string]KeyEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyList := make(map[string]KeyEntry)
+	if len(b) == 0 {
+		return keyList, nil
+	}
+	err = json.Unmarshal(b, &keyList)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyList, nil
+}
+
+// load reads the keyring file. When the file is corrupted, it is moved aside
+// and the backup written by the last successful save is restored instead.
+func (kr *KeyRing) load() error {
+	keyList, err := readKeyList(kr.filePath)
+	if os.IsNotExist(err) {
+		kr.keyList = make(map[string]KeyEntry)
+		return nil
+	}
+	if err == nil {
+		kr.keyList = keyList
+		return nil
+	}
+	if _, ok := err.(*os.PathError); ok {
+		return err
+	}
+
+	backup, berr := readKeyList(kr.backupPath())
+	if berr != nil {
+		return errors.New("Keyring file is corrupted and no usable backup: " + err.Error())
+	}
+	corrupted := kr.filePath + ".corrupted-" + time.Now().UTC().Format("20060102T150405")
+	err = os.Rename(kr.filePath, corrupted)
+	if err != nil {
+		return err
+	}
+	kr.keyList = backup
+
+	return kr.save()
+}
+
+func (kr *KeyRing) Load() error {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	// recovery may rewrite the file
+	return kr.withLock(true, kr.load)
+}
+
+// save writes the cached keys through a temporary file and a rename, then
+// copies them to the backup, so that restoring the backup never loses a
+// committed change.
+func (kr *KeyRing) save() error {
+	b, err := json.Marshal(kr.keyList)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(kr.filePath, b)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(kr.backupPath(), b)
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// update applies fn to the keys as currently on disk and saves the result.
+// Nothing is saved when fn fails. It is the only way changes are saved, so
+// that keys added by another process in the meantime are never written over.
+func (kr *KeyRing) update(fn func() error) error {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	return kr.withLock(true, func() error {
+		err := kr.load()
+		if err != nil {
+			return err
+		}
+		err = fn()
+		if err != nil {
+			// drop whatever fn changed in the cache
+			kr.load()
+			return err
+		}
+		return kr.save()
+	})
+}
+
+func (kr *KeyRing) AddKey(username string, key *KeyEntry) error {
+	if len(strings.TrimSpace(username)) == 0 {
+		return errors.New("Empty username")
+	}
+	return kr.update(func() error {
+		if _, ok := kr.keyList[username]; ok {
+			return errors.New("Username already exists")
+		}
+		for name, k := range kr.keyList {
+			if k.Address == key.Address {
+				return errors.New("Key already exists as " + name)
+			}
+		}
+		kr.keyList[username] = *key
+		return nil
+	})
+}
+
+func (kr *KeyRing) GenerateNewKey(username string, seed string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	key, err := GenerateKey(seed, passphrase, encrypt)
+	if err != nil {
+		return nil, errors.New("Fail to generate new key.")
+	}
+
+	return key, kr.AddKey(username, key)
+}
+
+func (kr *KeyRing) ImportNewKey(username string, keyBytes []byte, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	key, err := ImportKey(keyBytes, passphrase, encrypt)
+	if err != nil {
+		return nil, errors.New("Fail to import key.")
+	}
+
+	return key, kr.AddKey(username, key)
+}
+
+// DeriveNewKey adds the key at path under the fleet master.
+func (kr *KeyRing) DeriveNewKey(username string, master *HDKey, path string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	key, err := DeriveKey(master, path, passphrase, encrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, kr.AddKey(username, key)
+}
+
+// ImportNewMnemonic restores a key backed up with ExportMnemonic.
+func (kr *KeyRing) ImportNewMnemonic(username string, mnemonic string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	key, err := ImportMnemonic(mnemonic, passphrase, encrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, kr.AddKey(username, key)
+}
+
+// ExportMnemonic returns the backup phrase of the user's key.
+func (kr *KeyRing) ExportMnemonic(username string, passphrase []byte) (string, error) {
+	key, err := kr.Unlock(username, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return key.Mnemonic()
+}
+
+func (kr *KeyRing) GetKey(username string) *KeyEntry {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	key, ok := kr.keyList[username]
+	if !ok {
+		return nil
+	}
+	return &key
+}
+
+// GetKeyByAddress returns the key with the given address and its username.
+func (kr *KeyRing) GetKeyByAddress(address string) (string, *KeyEntry) {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	address = strings.ToUpper(address)
+	for name, key := range kr.keyList {
+		if key.Address == address {
+			key := key
+			return name, &key
+		}
+	}
+	return "", nil
+}
+
+// GetKeyList returns the usernames in the keyring, sorted.
+func (kr *KeyRing) GetKeyList() []string {
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	names := make([]string, 0, len(kr.keyList))
+	for name := range kr.keyList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Unlock returns a decrypted copy of the user's key. A key stored in an
+// outdated encryption format is upgraded and saved on the way.
+func (kr *KeyRing) Unlock(username string, passphrase []byte) (*KeyEntry, error) {
+	key := kr.GetKey(username)
+	if key == nil {
+		return nil, errors.New("Username not found")
+	}
+	if key.NeedsUpgrade() {
+		err := kr.update(func() error {
+			stored, ok := kr.keyList[username]
+			if !ok || stored.Address != key.Address {
+				return errors.New("Key changed while unlocking")
+			}
+			_, err := stored.Upgrade(passphrase)
+			if err != nil {
+				return err
+			}
+			kr.keyList[username] = stored
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		key = kr.GetKey(username)
+	}
+	if !key.Encrypted {
+		return key, nil
+	}
+	err := key.Decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (kr *KeyRing) RenameKey(username, newname string) error {
+	if len(strings.TrimSpace(newname)) == 0 {
+		return errors.New("Empty username")
+	}
+	return kr.update(func() error {
+		key, ok := kr.keyList[username]
+		if !ok {
+			return errors.New("Username not found")
+		}
+		if _, ok := kr.keyList[newname]; ok {
+			return errors.New("Username already exists")
+		}
+		delete(kr.keyList, username)
+		kr.keyList[newname] = key
+		return nil
+	})
+}
+
+func (kr *KeyRing) RemoveKey(username string) error {
+	return kr.update(func() error {
+		_, ok := kr.keyList[username]
+		if !ok {
+			return errors.New("Username not found")
+		}
+		delete(kr.keyList, username)
+		return nil
+	})
+}
@@ -1,7 +1,12 @@
 package keys
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,68 +16,6 @@ const (
 	testfile = "test_keyring.json"
 )
 
-type KeyRing struct {
-	filePath string
-	keyList  map[string]KeyEntry // just a cache
-}
-
-func (kr *KeyRing) Save() error {
-	err := util.EnsureFile(kr.filePath)
-	if err != nil {
-		return err
-	}
-
-	b, err := json.Marshal(kr.keyList)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(kr.filePath, b, 0600)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (kr *KeyRing) GenerateNewKey(username string, seed string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
-	key, err := GenerateKey(seed, passphrase, encrypt)
-	if err != nil {
-		return nil, errors.New("Fail to generate new key.")
-	}
-
-	return key, kr.AddKey(username, key)
-}
-
-func (kr *KeyRing) ImportNewKey(username string, keyBytes []byte, passphrase []byte, encrypt bool) (*KeyEntry, error) {
-	key, err := ImportKey(keyBytes, passphrase, encrypt)
-	if err != nil {
-		return nil, errors.New("Fail to import key.")
-	}
-
-	return key, kr.AddKey(username, key)
-}
-
-func (kr *KeyRing) GetKey(username string) *KeyEntry {
-	key, ok := kr.keyList[username]
-	if !ok {
-		return nil
-	}
-	return &key
-}
-
-func (kr *KeyRing) RemoveKey(username string) error {
-	_, ok := kr.keyList[username]
-	if !ok {
-		return errors.New("Username not found")
-	}
-
-	delete(kr.keyList, username)
-
-	return kr.Save()
-}
-
-
 func TestGenKey(t *testing.T) {
 	kr, err := GetKeyRing(testfile)
 	assert.NoError(t, err)
@@ -116,4 +59,215 @@ func TestGenKey(t *testing.T) {
 	assert.False(t, key.Encrypted)
 
 	_tearDown()
-}
\ No newline at end of file
+}
+
+func _tearDown() {
+	os.Remove(testfile)
+	os.Remove(testfile + ".bak")
+	os.Remove(testfile + ".lock")
+}
+
+func TestKeyRingManage(t *testing.T) {
+	defer _tearDown()
+	_tearDown()
+
+	kr, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+
+	key, err := kr.GenerateNewKey("u1", "seed1", nil, false)
+	assert.NoError(t, err)
+
+	// duplicate name and duplicate key
+	_, err = kr.GenerateNewKey("u1", "seed2", nil, false)
+	assert.Error(t, err)
+	_, err = kr.GenerateNewKey("u2", "seed1", []byte("pass"), true)
+	assert.Error(t, err)
+	_, err = kr.GenerateNewKey("", "seed2", nil, false)
+	assert.Error(t, err)
+	_, err = kr.ImportNewKey("u2", key.PrivKey, nil, false)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"u1"}, kr.GetKeyList())
+
+	_, err = kr.GenerateNewKey("u2", "seed2", nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, kr.GetKeyList())
+
+	name, found := kr.GetKeyByAddress(key.Address)
+	assert.Equal(t, "u1", name)
+	assert.Equal(t, key, found)
+
+	// rename
+	assert.Error(t, kr.RenameKey("u1", "u2"))
+	assert.Error(t, kr.RenameKey("u3", "u4"))
+	assert.NoError(t, kr.RenameKey("u1", "rsu1"))
+	assert.Nil(t, kr.GetKey("u1"))
+	assert.Equal(t, key, kr.GetKey("rsu1"))
+
+	kr2, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rsu1", "u2"}, kr2.GetKeyList())
+
+	// changes by another instance are not lost
+	assert.NoError(t, kr2.RemoveKey("u2"))
+	_, err = kr.GenerateNewKey("u3", "seed3", nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rsu1", "u3"}, kr.GetKeyList())
+	assert.NoError(t, kr2.Load())
+	assert.Equal(t, []string{"rsu1", "u3"}, kr2.GetKeyList())
+
+	info, err := os.Stat(testfile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestKeyRingUnlock(t *testing.T) {
+	defer _tearDown()
+	_tearDown()
+
+	plain, err := GenerateKey("test", nil, false)
+	assert.NoError(t, err)
+	legacy, err := GenerateKey("test", nil, false)
+	assert.NoError(t, err)
+	legacy.Encrypted = true
+	legacy.PrivKey = legacyEncrypt(plain.PrivKey, []byte("pass"))
+	b, err := json.Marshal(map[string]KeyEntry{"old": *legacy})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(testfile, b, 0600))
+
+	kr, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+	_, err = kr.Unlock("old", []byte("wrong"))
+	assert.Error(t, err)
+	assert.True(t, kr.GetKey("old").NeedsUpgrade())
+
+	key, err := kr.Unlock("old", []byte("pass"))
+	assert.NoError(t, err)
+	assert.Equal(t, plain, key)
+
+	// upgraded on disk, still encrypted
+	assert.NoError(t, kr.Load())
+	stored := kr.GetKey("old")
+	assert.True(t, stored.Encrypted)
+	assert.False(t, stored.NeedsUpgrade())
+	key, err = kr.Unlock("old", []byte("pass"))
+	assert.NoError(t, err)
+	assert.Equal(t, plain, key)
+}
+
+func TestKeyRingRecover(t *testing.T) {
+	defer _tearDown()
+	_tearDown()
+	defer func() {
+		matches, _ := filepath.Glob(testfile + ".corrupted-*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+
+	kr, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+	_, err = kr.GenerateNewKey("u1", "seed1", nil, false)
+	assert.NoError(t, err)
+	_, err = kr.GenerateNewKey("u2", "seed2", nil, false)
+	assert.NoError(t, err)
+
+	// torn write
+	b, err := ioutil.ReadFile(testfile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(testfile, b[:len(b)/2], 0600))
+
+	// nothing committed is lost
+	kr, err = GetKeyRing(testfile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, kr.GetKeyList())
+	matches, err := filepath.Glob(testfile + ".corrupted-*")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(matches))
+
+	// both broken
+	assert.NoError(t, ioutil.WriteFile(testfile, []byte("{"), 0600))
+	assert.NoError(t, ioutil.WriteFile(testfile+".bak", []byte("{"), 0600))
+	_, err = GetKeyRing(testfile)
+	assert.Error(t, err)
+}
+
+func TestKeyRingConcurrent(t *testing.T) {
+	defer _tearDown()
+	_tearDown()
+
+	const writers = 8
+	const perWriter = 5
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// separate instances behave like separate processes
+			kr, err := GetKeyRing(testfile)
+			assert.NoError(t, err)
+			for i := 0; i < perWriter; i++ {
+				name := fmt.Sprintf("w%d-%d", w, i)
+				_, err = kr.GenerateNewKey(name, name, nil, false)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	kr, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+	assert.Equal(t, writers*perWriter, len(kr.GetKeyList()))
+
+	// racing for the same name, only one wins
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			kr, err := GetKeyRing(testfile)
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = kr.GenerateNewKey("same", fmt.Sprintf("seed%d", w), nil, false)
+			errs <- err
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	ok := 0
+	for err := range errs {
+		if err == nil {
+			ok++
+		}
+	}
+	assert.Equal(t, 1, ok)
+}
+
+func TestKeyRingMnemonic(t *testing.T) {
+	defer _tearDown()
+	_tearDown()
+
+	kr, err := GetKeyRing(testfile)
+	assert.NoError(t, err)
+	key, err := kr.GenerateNewKey("rsu", "", []byte("pass"), true)
+	assert.NoError(t, err)
+
+	_, err = kr.ExportMnemonic("rsu", []byte("wrong"))
+	assert.Error(t, err)
+	mnemonic, err := kr.ExportMnemonic("rsu", []byte("pass"))
+	assert.NoError(t, err)
+
+	// same identity cannot be added twice
+	_, err = kr.ImportNewMnemonic("rsu-copy", mnemonic, nil, false)
+	assert.Error(t, err)
+
+	// replaced unit re-provisioned from the phrase
+	assert.NoError(t, kr.RemoveKey("rsu"))
+	restored, err := kr.ImportNewMnemonic("rsu", mnemonic, []byte("newpass"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Address, restored.Address)
+	unlocked, err := kr.Unlock("rsu", []byte("newpass"))
+	assert.NoError(t, err)
+	assert.Equal(t, key.PubKey, unlocked.PubKey)
+}
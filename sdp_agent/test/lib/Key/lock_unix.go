@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package keys
+
+import (
+	"os"
+	"syscall"
+)
+
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile takes a flock on path, creating it if needed, and blocks until
+// the lock is granted.
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &fileLock{f}, nil
+}
+
+func (l *fileLock) unlock() error {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
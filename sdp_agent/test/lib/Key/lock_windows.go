@@ -0,0 +1,36 @@
+package keys
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile takes a LockFileEx lock on path, creating it if needed, and
+// blocks until the lock is granted.
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	err = windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, new(windows.Overlapped))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &fileLock{f}, nil
+}
+
+func (l *fileLock) unlock() error {
+	windows.UnlockFileEx(windows.Handle(l.f.Fd()), 0, 1, 0, new(windows.Overlapped))
+	return l.f.Close()
+}
@@ -0,0 +1,41 @@
+package keys
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+const mnemonicWords = 24
+
+// Mnemonic encodes the private key as a 24-word BIP-39 phrase. The 256 bits
+// of entropy behind the phrase are the private key itself, so the phrase
+// restores exactly this key and address. The key must be decrypted first.
+func (key *KeyEntry) Mnemonic() (string, error) {
+	if key.Encrypted {
+		return "", errors.New("The key is encrypted")
+	}
+	if len(key.PrivKey) != 32 {
+		return "", errors.New("Wrong private key size")
+	}
+	return bip39.NewMnemonic(key.PrivKey)
+}
+
+func ImportMnemonic(mnemonic string, passphrase []byte, encrypt bool) (*KeyEntry, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) != mnemonicWords {
+		return nil, errors.New("Mnemonic must have 24 words")
+	}
+	keyBytes, err := bip39.EntropyFromMnemonic(strings.Join(words, " "))
+	if err != nil {
+		return nil, errors.New("Invalid mnemonic: wrong word or checksum")
+	}
+	d := new(big.Int).SetBytes(keyBytes)
+	if d.Sign() == 0 || d.Cmp(c.Params().N) >= 0 {
+		return nil, errors.New("Mnemonic is not a valid private key")
+	}
+
+	return ImportKey(keyBytes, passphrase, encrypt)
+}
@@ -0,0 +1,257 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"sort"
+)
+
+const (
+	// first byte of an encoded multisig, apart from the 0x02, 0x03 and 0x04
+	// that start a single public key
+	multisigTag     = 0x4d
+	maxMultisigKeys = 16
+)
+
+// Multisig is an M-of-N account, such as a parcel co-owned by a city and an
+// operator. Its public key is the encoding of the threshold and the member
+// keys, and its address is derived from that as from any public key, so the
+// chain and the storage tell the two apart only by the key.
+type Multisig struct {
+	Threshold int
+	PubKeys   [][]byte
+}
+
+// NewMultisig makes the account of threshold out of pubKeys. The keys are
+// sorted, so that the order they are given in does not change the address.
+func NewMultisig(threshold int, pubKeys [][]byte) (*Multisig, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > maxMultisigKeys {
+		return nil, errors.New("A multisig takes 1 to 16 keys")
+	}
+	if threshold < 1 || threshold > len(pubKeys) {
+		return nil, errors.New("Multisig threshold out of range")
+	}
+	members := make([][]byte, 0, len(pubKeys))
+	for _, pubKey := range pubKeys {
+		X, Y, err := parsePubKey(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, elliptic.Marshal(c, X, Y))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i], members[j]) < 0
+	})
+	for i := 1; i < len(members); i++ {
+		if bytes.Equal(members[i-1], members[i]) {
+			return nil, errors.New("Duplicate key in multisig")
+		}
+	}
+
+	return &Multisig{Threshold: threshold, PubKeys: members}, nil
+}
+
+// IsMultisig tells an encoded multisig from a single public key.
+func IsMultisig(pubKey []byte) bool {
+	return len(pubKey) > 0 && pubKey[0] == multisigTag
+}
+
+// Encode returns the multisig public key: the tag, the threshold, the number
+// of keys and the uncompressed keys in order.
+func (m *Multisig) Encode() []byte {
+	b := make([]byte, 0, 3+len(m.PubKeys)*pubKeySize)
+	b = append(b, multisigTag, byte(m.Threshold), byte(len(m.PubKeys)))
+	for _, pubKey := range m.PubKeys {
+		b = append(b, pubKey...)
+	}
+	return b
+}
+
+func DecodeMultisig(b []byte) (*Multisig, error) {
+	if !IsMultisig(b) || len(b) < 3 {
+		return nil, errors.New("Not a multisig public key")
+	}
+	n := int(b[2])
+	if len(b) != 3+n*pubKeySize {
+		return nil, errors.New("Wrong multisig public key size")
+	}
+	pubKeys := make([][]byte, n)
+	for i := range pubKeys {
+		pubKeys[i] = b[3+i*pubKeySize : 3+(i+1)*pubKeySize]
+	}
+	m, err := NewMultisig(int(b[1]), pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	// one account, one key
+	if !bytes.Equal(m.Encode(), b) {
+		return nil, errors.New("Multisig keys out of order")
+	}
+
+	return m, nil
+}
+
+func (m *Multisig) Address() string {
+	return DeriveAddress(m.Encode())
+}
+
+func (m *Multisig) index(pubKey []byte) int {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil {
+		return -1
+	}
+	b := elliptic.Marshal(c, X, Y)
+	for i, member := range m.PubKeys {
+		if bytes.Equal(member, b) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PartialSig is the signature of one member toward a multisig signature.
+// Members sign apart, each on their own box, and pass these around for
+// whoever collects them to Combine.
+type PartialSig struct {
+	PubKey []byte `json:"pub_key"`
+	Sig    []byte `json:"sig"`
+}
+
+func (m *Multisig) SignPartial(signer Signer, msg []byte) (*PartialSig, error) {
+	if m.index(signer.PublicKey()) < 0 {
+		return nil, errors.New("Signer " + signer.GetAddress() + " is not a member of the multisig")
+	}
+	sig, err := signer.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &PartialSig{PubKey: signer.PublicKey(), Sig: sig}, nil
+}
+
+func (m *Multisig) verifyPartial(msg []byte, p *PartialSig) (int, error) {
+	i := m.index(p.PubKey)
+	if i < 0 {
+		return -1, errors.New("Partial signature by a non-member " + DeriveAddress(p.PubKey))
+	}
+	if !Verify(m.PubKeys[i], msg, p.Sig) {
+		return -1, errors.New("Invalid partial signature by " + DeriveAddress(p.PubKey))
+	}
+	return i, nil
+}
+
+// VerifyPartial checks a partial signature over msg by a member.
+func (m *Multisig) VerifyPartial(msg []byte, p *PartialSig) error {
+	_, err := m.verifyPartial(msg, p)
+	return err
+}
+
+// Combine checks the partial signatures over msg and, given enough of them,
+// returns the multisig signature: a bitmap of the members who signed,
+// followed by their signatures in key order. Only the first Threshold
+// members are taken; a partial signature that is wrong fails the whole.
+func (m *Multisig) Combine(msg []byte, partials []*PartialSig) ([]byte, error) {
+	sigs := make([][]byte, len(m.PubKeys))
+	for _, p := range partials {
+		i, err := m.verifyPartial(msg, p)
+		if err != nil {
+			return nil, err
+		}
+		sigs[i] = p.Sig
+	}
+
+	bitmap := make([]byte, (len(m.PubKeys)+7)/8)
+	var combined []byte
+	count := 0
+	for i, sig := range sigs {
+		if sig == nil || count == m.Threshold {
+			continue
+		}
+		bitmap[i/8] |= 0x80 >> uint(i%8)
+		combined = append(combined, sig...)
+		count++
+	}
+	if count < m.Threshold {
+		return nil, errors.New("Not enough partial signatures for the multisig")
+	}
+
+	return append(bitmap, combined...), nil
+}
+
+// Verify checks a signature made by Combine.
+func (m *Multisig) Verify(msg []byte, sig []byte) bool {
+	n := (len(m.PubKeys) + 7) / 8
+	if len(sig) < n {
+		return false
+	}
+	bitmap, sigs := sig[:n], sig[n:]
+	// bits past the last member must be clear, or the same signature could
+	// be sent in several forms
+	if k := uint(len(m.PubKeys) % 8); k > 0 && bitmap[n-1]&(0xff>>k) != 0 {
+		return false
+	}
+	count := 0
+	for i, pubKey := range m.PubKeys {
+		if bitmap[i/8]&(0x80>>uint(i%8)) == 0 {
+			continue
+		}
+		if len(sigs) < sigSize || !Verify(pubKey, msg, sigs[:sigSize]) {
+			return false
+		}
+		sigs = sigs[sigSize:]
+		count++
+	}
+	return len(sigs) == 0 && count >= m.Threshold
+}
+
+// VerifyAccount checks a signature by an account, whose public key is
+// either a single key or an encoded multisig.
+func VerifyAccount(pubKey []byte, msg []byte, sig []byte) bool {
+	if !IsMultisig(pubKey) {
+		return Verify(pubKey, msg, sig)
+	}
+	m, err := DecodeMultisig(pubKey)
+	if err != nil {
+		return false
+	}
+	return m.Verify(msg, sig)
+}
+
+// MultisigSigner signs for a multisig with member signers that are all at
+// hand, as when one box holds the keys of both co-owners in its HSM.
+type MultisigSigner struct {
+	*Multisig
+	Signers []Signer
+}
+
+func NewMultisigSigner(m *Multisig, signers ...Signer) (*MultisigSigner, error) {
+	for _, s := range signers {
+		if m.index(s.PublicKey()) < 0 {
+			return nil, errors.New("Signer " + s.GetAddress() + " is not a member of the multisig")
+		}
+	}
+	if len(signers) < m.Threshold {
+		return nil, errors.New("Not enough signers for the multisig")
+	}
+	return &MultisigSigner{Multisig: m, Signers: signers}, nil
+}
+
+func (s *MultisigSigner) PublicKey() []byte {
+	return s.Encode()
+}
+
+func (s *MultisigSigner) GetAddress() string {
+	return s.Address()
+}
+
+func (s *MultisigSigner) Sign(msg []byte) ([]byte, error) {
+	partials := make([]*PartialSig, 0, len(s.Signers))
+	for _, signer := range s.Signers[:s.Threshold] {
+		p, err := s.SignPartial(signer, msg)
+		if err != nil {
+			return nil, err
+		}
+		partials = append(partials, p)
+	}
+	return s.Combine(msg, partials)
+}
@@ -0,0 +1,96 @@
+package keys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultisig(t *testing.T) {
+	city, _ := GenerateKey("city", nil, false)
+	operator, _ := GenerateKey("operator", nil, false)
+	auditor, _ := GenerateKey("auditor", nil, false)
+	outsider, _ := GenerateKey("outsider", nil, false)
+
+	m, err := NewMultisig(2, [][]byte{city.PubKey, operator.PubKey, auditor.PubKey})
+	assert.NoError(t, err)
+	compressed, _ := CompressPubKey(city.PubKey)
+	same, err := NewMultisig(2, [][]byte{auditor.PubKey, compressed, operator.PubKey})
+	assert.NoError(t, err)
+	assert.Equal(t, m.Address(), same.Address())
+	other, _ := NewMultisig(1, [][]byte{city.PubKey, operator.PubKey, auditor.PubKey})
+	assert.NotEqual(t, m.Address(), other.Address())
+	assert.Equal(t, DeriveAddress(m.Encode()), m.Address())
+
+	decoded, err := DecodeMultisig(m.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, m, decoded)
+	assert.True(t, IsMultisig(m.Encode()))
+	assert.False(t, IsMultisig(city.PubKey))
+
+	_, err = NewMultisig(0, [][]byte{city.PubKey})
+	assert.Error(t, err)
+	_, err = NewMultisig(2, [][]byte{city.PubKey})
+	assert.Error(t, err)
+	_, err = NewMultisig(1, [][]byte{city.PubKey, compressed})
+	assert.Error(t, err)
+	_, err = NewMultisig(1, [][]byte{[]byte("junk")})
+	assert.Error(t, err)
+	swapped := m.Encode()
+	copy(swapped[3:], m.PubKeys[1])
+	copy(swapped[3+65:], m.PubKeys[0])
+	_, err = DecodeMultisig(swapped)
+	assert.Error(t, err)
+
+	msg := []byte("remove parcel AB01")
+	p1, err := m.SignPartial(city, msg)
+	assert.NoError(t, err)
+	p2, err := m.SignPartial(auditor, msg)
+	assert.NoError(t, err)
+	_, err = m.SignPartial(outsider, msg)
+	assert.Error(t, err)
+
+	// below the threshold
+	_, err = m.Combine(msg, []*PartialSig{p1})
+	assert.Error(t, err)
+	_, err = m.Combine(msg, []*PartialSig{p1, p1})
+	assert.Error(t, err)
+
+	sig, err := m.Combine(msg, []*PartialSig{p2, p1})
+	assert.NoError(t, err)
+	assert.True(t, m.Verify(msg, sig))
+	assert.True(t, VerifyAccount(m.Encode(), msg, sig))
+	assert.False(t, VerifyAccount(m.Encode(), []byte("remove parcel AB02"), sig))
+	stranger, _ := NewMultisig(2, [][]byte{operator.PubKey, outsider.PubKey})
+	assert.False(t, VerifyAccount(stranger.Encode(), msg, sig))
+	assert.False(t, m.Verify(msg, sig[:len(sig)-1]))
+	// a bitmap claiming a signer that did not sign
+	forged := append([]byte{}, sig...)
+	forged[0] |= 0x80 | 0x40 | 0x20
+	assert.False(t, m.Verify(msg, forged))
+	// padding bits past the last member
+	forged = append([]byte{}, sig...)
+	forged[0] |= 0x01
+	assert.False(t, m.Verify(msg, forged))
+
+	// partials over another message
+	p3, _ := m.SignPartial(operator, []byte("something else"))
+	_, err = m.Combine(msg, []*PartialSig{p1, p3})
+	assert.Error(t, err)
+
+	// all members at hand
+	signer, err := NewMultisigSigner(m, operator, city)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Address(), signer.GetAddress())
+	sig, err = signer.Sign(msg)
+	assert.NoError(t, err)
+	assert.True(t, VerifyAccount(signer.PublicKey(), msg, sig))
+	_, err = NewMultisigSigner(m, operator)
+	assert.Error(t, err)
+	_, err = NewMultisigSigner(m, operator, outsider)
+	assert.Error(t, err)
+
+	// a single key still verifies as before
+	sig, _ = city.Sign(msg)
+	assert.True(t, VerifyAccount(city.PubKey, msg, sig))
+}
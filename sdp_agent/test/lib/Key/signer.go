@@ -0,0 +1,68 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const sigSize = 64
+
+// Signer is anything that can sign on behalf of an account without
+// necessarily exposing the private key, e.g. a key held in a TPM or HSM.
+// Signatures are P-256 ECDSA over sha256(msg), encoded as r and s in 32 bytes
+// each.
+//
+// GetAddress is not named Address because KeyEntry already has a field of
+// that name.
+type Signer interface {
+	PublicKey() []byte
+	GetAddress() string
+	Sign(msg []byte) ([]byte, error)
+}
+
+func (key *KeyEntry) PublicKey() []byte {
+	return key.PubKey
+}
+
+func (key *KeyEntry) GetAddress() string {
+	return key.Address
+}
+
+func (key *KeyEntry) Sign(msg []byte) ([]byte, error) {
+	if key.Encrypted {
+		return nil, errors.New("The key is encrypted")
+	}
+	hash := sha256.Sum256(msg)
+	return signDigest(key.PrivKey, hash[:])
+}
+
+func signDigest(privKeyBytes []byte, digest []byte) ([]byte, error) {
+	privKey, err := setECDSAKey(privKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, sigSize)
+	fillInt(sig[:32], 32, r)
+	fillInt(sig[32:], 32, s)
+
+	return sig, nil
+}
+
+// Verify checks a signature made by a Signer over msg.
+func Verify(pubKey []byte, msg []byte, sig []byte) bool {
+	X, Y, err := parsePubKey(pubKey)
+	if err != nil || len(sig) != sigSize {
+		return false
+	}
+	hash := sha256.Sum256(msg)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: c, X: X, Y: Y}, hash[:], r, s)
+}
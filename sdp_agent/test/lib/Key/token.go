@@ -0,0 +1,282 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Token is the contract for key store plugins, modelled on PKCS#11: a token
+// holds key pairs addressed by label, signing requires a login with a PIN,
+// and private keys never leave the token. Sign takes a sha256 digest, as
+// CKM_ECDSA does, and returns r and s in 32 bytes each.
+//
+// A PKCS#11 adapter (SoftHSM, a TPM or a real HSM) registers itself with
+// RegisterToken under its own name; FileToken is the software implementation
+// that ships with this package.
+type Token interface {
+	Login(pin []byte) error
+	Logout() error
+	GenerateKeyPair(label string) ([]byte, error)
+	PublicKey(label string) ([]byte, error)
+	Sign(label string, digest []byte) ([]byte, error)
+	Labels() ([]string, error)
+	Close() error
+}
+
+// TokenOpener opens a token from a plugin specific config string, such as a
+// directory or a module path and slot.
+type TokenOpener func(config string) (Token, error)
+
+var (
+	tokenMtx     sync.Mutex
+	tokenOpeners = map[string]TokenOpener{}
+)
+
+func init() {
+	RegisterToken("file", func(config string) (Token, error) {
+		return OpenFileToken(config)
+	})
+}
+
+// RegisterToken makes a token plugin available to OpenToken.
+func RegisterToken(name string, opener TokenOpener) {
+	tokenMtx.Lock()
+	defer tokenMtx.Unlock()
+	tokenOpeners[name] = opener
+}
+
+func OpenToken(name string, config string) (Token, error) {
+	tokenMtx.Lock()
+	opener, ok := tokenOpeners[name]
+	tokenMtx.Unlock()
+	if !ok {
+		return nil, errors.New("Unknown token plugin: " + name)
+	}
+	return opener(config)
+}
+
+// TokenSigner is a Signer backed by a key pair on a Token.
+type TokenSigner struct {
+	token   Token
+	label   string
+	pubKey  []byte
+	address string
+}
+
+func NewTokenSigner(token Token, label string) (*TokenSigner, error) {
+	pubKey, err := token.PublicKey(label)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = parsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSigner{
+		token:   token,
+		label:   label,
+		pubKey:  pubKey,
+		address: DeriveAddress(pubKey),
+	}, nil
+}
+
+func (s *TokenSigner) PublicKey() []byte {
+	return s.pubKey
+}
+
+func (s *TokenSigner) GetAddress() string {
+	return s.address
+}
+
+func (s *TokenSigner) Sign(msg []byte) ([]byte, error) {
+	hash := sha256.Sum256(msg)
+	return s.token.Sign(s.label, hash[:])
+}
+
+// FileToken keeps each key pair as a KeyEntry encrypted with the PIN in its
+// own file under a directory. It gives hardware-free setups and tests the same
+// interface as an HSM.
+type FileToken struct {
+	dir string
+	mtx sync.Mutex
+	pin []byte
+}
+
+func OpenFileToken(dir string) (*FileToken, error) {
+	if len(dir) == 0 {
+		return nil, errors.New("Empty token directory")
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileToken{dir: dir}, nil
+}
+
+func (t *FileToken) path(label string) (string, error) {
+	if len(label) == 0 || strings.ContainsAny(label, `/\`) || label[0] == '.' {
+		return "", errors.New("Invalid key label")
+	}
+	return filepath.Join(t.dir, label+".json"), nil
+}
+
+func (t *FileToken) load(label string) (*KeyEntry, error) {
+	path, err := t.path(label)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.New("Key not found: " + label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := new(KeyEntry)
+	err = json.Unmarshal(b, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Login checks the PIN against the stored keys, if there are any.
+func (t *FileToken) Login(pin []byte) error {
+	labels, err := t.Labels()
+	if err != nil {
+		return err
+	}
+	if len(labels) > 0 {
+		key, err := t.load(labels[0])
+		if err != nil {
+			return err
+		}
+		err = key.Decrypt(pin)
+		if err != nil {
+			return errors.New("Incorrect PIN")
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.pin = append([]byte{}, pin...)
+	return nil
+}
+
+func (t *FileToken) Logout() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	zero(t.pin)
+	t.pin = nil
+	return nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// getPin returns a copy of the PIN, so that a Logout meanwhile does not wipe
+// it under the caller. The caller zeroes the copy once done.
+func (t *FileToken) getPin() ([]byte, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.pin == nil {
+		return nil, errors.New("Not logged in")
+	}
+	return append([]byte{}, t.pin...), nil
+}
+
+func (t *FileToken) GenerateKeyPair(label string) ([]byte, error) {
+	pin, err := t.getPin()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(pin)
+	path, err := t.path(label)
+	if err != nil {
+		return nil, err
+	}
+	key, err := GenerateKey("", pin, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, errors.New("Key already exists: " + label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return key.PubKey, nil
+}
+
+func (t *FileToken) PublicKey(label string) ([]byte, error) {
+	key, err := t.load(label)
+	if err != nil {
+		return nil, err
+	}
+	return key.PubKey, nil
+}
+
+func (t *FileToken) Sign(label string, digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, errors.New("Wrong digest size")
+	}
+	pin, err := t.getPin()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(pin)
+	key, err := t.load(label)
+	if err != nil {
+		return nil, err
+	}
+	err = key.Decrypt(pin)
+	if err != nil {
+		return nil, err
+	}
+	return signDigest(key.PrivKey, digest)
+}
+
+func (t *FileToken) Labels() ([]string, error) {
+	files, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || name[0] == '.' || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		labels = append(labels, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (t *FileToken) Close() error {
+	return t.Logout()
+}
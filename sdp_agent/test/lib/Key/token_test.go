@@ -0,0 +1,129 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyEntrySigner(t *testing.T) {
+	key, err := GenerateKey("test", nil, false)
+	assert.NoError(t, err)
+
+	var signer Signer = key
+	assert.Equal(t, key.Address, signer.GetAddress())
+	assert.Equal(t, key.PubKey, signer.PublicKey())
+
+	sig, err := signer.Sign([]byte("token"))
+	assert.NoError(t, err)
+	assert.Equal(t, 64, len(sig))
+	assert.True(t, Verify(key.PubKey, []byte("token"), sig))
+	assert.False(t, Verify(key.PubKey, []byte("other"), sig))
+
+	other, err := GenerateKey("other", nil, false)
+	assert.NoError(t, err)
+	assert.False(t, Verify(other.PubKey, []byte("token"), sig))
+
+	enc, err := GenerateKey("test", []byte("pass"), true)
+	assert.NoError(t, err)
+	_, err = enc.Sign([]byte("token"))
+	assert.Error(t, err)
+}
+
+func TestFileToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = OpenToken("nonexistent", dir)
+	assert.Error(t, err)
+	token, err := OpenToken("file", dir)
+	assert.NoError(t, err)
+	defer token.Close()
+
+	// nothing works before login
+	_, err = token.GenerateKeyPair("rsu1")
+	assert.Error(t, err)
+
+	assert.NoError(t, token.Login([]byte("1234")))
+	pubKey, err := token.GenerateKeyPair("rsu1")
+	assert.NoError(t, err)
+	assert.Equal(t, 65, len(pubKey))
+	_, err = token.GenerateKeyPair("rsu1")
+	assert.Error(t, err)
+	_, err = token.GenerateKeyPair("../rsu1")
+	assert.Error(t, err)
+	_, err = token.GenerateKeyPair("rsu2")
+	assert.NoError(t, err)
+
+	labels, err := token.Labels()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rsu1", "rsu2"}, labels)
+
+	// private key is not stored in the clear
+	b, err := ioutil.ReadFile(dir + "/rsu1.json")
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"encrypted":true`)
+
+	signer, err := NewTokenSigner(token, "rsu1")
+	assert.NoError(t, err)
+	assert.Equal(t, pubKey, signer.PublicKey())
+	assert.Equal(t, DeriveAddress(pubKey), signer.GetAddress())
+	sig, err := signer.Sign([]byte("token"))
+	assert.NoError(t, err)
+	assert.True(t, Verify(pubKey, []byte("token"), sig))
+
+	digest := sha256.Sum256([]byte("token"))
+	_, err = token.Sign("rsu1", digest[:4])
+	assert.Error(t, err)
+	_, err = token.Sign("rsu3", digest[:])
+	assert.Error(t, err)
+	_, err = NewTokenSigner(token, "rsu3")
+	assert.Error(t, err)
+
+	assert.NoError(t, token.Logout())
+	_, err = signer.Sign([]byte("token"))
+	assert.Error(t, err)
+
+	// reopen with the wrong and right PIN
+	token2, err := OpenFileToken(dir)
+	assert.NoError(t, err)
+	assert.Error(t, token2.Login([]byte("0000")))
+	assert.NoError(t, token2.Login([]byte("1234")))
+	signer, err = NewTokenSigner(token2, "rsu2")
+	assert.NoError(t, err)
+	_, err = signer.Sign([]byte("token"))
+	assert.NoError(t, err)
+}
+
+func TestFileTokenLogoutWhileSigning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	token, err := OpenFileToken(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, token.Login([]byte("1234")))
+
+	// a PIN in use is not wiped by a logout meanwhile
+	pin, err := token.getPin()
+	assert.NoError(t, err)
+	assert.NoError(t, token.Logout())
+	assert.Equal(t, []byte("1234"), pin)
+
+	assert.NoError(t, token.Login([]byte("1234")))
+	_, err = token.GenerateKeyPair("rsu1")
+	assert.NoError(t, err)
+	digest := sha256.Sum256([]byte("token"))
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			token.Sign("rsu1", digest[:])
+		}
+		close(done)
+	}()
+	token.Logout()
+	<-done
+}
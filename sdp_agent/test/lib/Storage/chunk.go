@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+var (
+	// ChunkSize is the size of every chunk but the last one in a chunked
+	// upload. Changing it invalidates existing resume journals.
+	ChunkSize int64 = 4 << 20
+)
+
+// UploadJournal records the progress of a chunked upload so that it can be
+// resumed after a failure without sending the finished chunks again.
+type UploadJournal struct {
+	Hash      string   `json:"hash"`
+	Size      int64    `json:"size"`
+	ChunkSize int64    `json:"chunk_size"`
+	Chunks    []string `json:"chunks"`
+	Done      []bool   `json:"done"`
+}
+
+// Manifest finalizes a chunked upload. The server assembles the parcel from
+// the listed chunks in order and checks it against Hash.
+type Manifest struct {
+	Owner     string          `json:"owner"`
+	Metadata  json.RawMessage `json:"metadata"`
+	Hash      string          `json:"hash"`
+	Size      int64           `json:"size"`
+	ChunkSize int64           `json:"chunk_size"`
+	Chunks    []string        `json:"chunks"`
+}
+
+func newUploadJournal(data io.ReaderAt, size int64) (*UploadJournal, error) {
+	j := &UploadJournal{
+		Size:      size,
+		ChunkSize: ChunkSize,
+	}
+	whole := sha256.New()
+	for off := int64(0); off < size; off += ChunkSize {
+		h := sha256.New()
+		r := io.NewSectionReader(data, off, chunkLen(off, size))
+		_, err := io.Copy(io.MultiWriter(h, whole), r)
+		if err != nil {
+			return nil, err
+		}
+		j.Chunks = append(j.Chunks, hexSum(h))
+	}
+	j.Hash = hexSum(whole)
+	j.Done = make([]bool, len(j.Chunks))
+
+	return j, nil
+}
+
+func chunkLen(off, size int64) int64 {
+	if size-off < ChunkSize {
+		return size - off
+	}
+	return ChunkSize
+}
+
+// loadUploadJournal returns the journal at path if it describes the same
+// parcel as j, and j itself otherwise.
+func loadUploadJournal(path string, j *UploadJournal) *UploadJournal {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return j
+	}
+	var saved UploadJournal
+	err = json.Unmarshal(b, &saved)
+	if err != nil ||
+		saved.Hash != j.Hash ||
+		saved.Size != j.Size ||
+		saved.ChunkSize != j.ChunkSize ||
+		len(saved.Chunks) != len(j.Chunks) ||
+		len(saved.Done) != len(j.Chunks) {
+		return j
+	}
+
+	return &saved
+}
+
+func (j *UploadJournal) save(path string) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Client) doUploadChunk(ctx context.Context, hash string, chunk io.Reader, token, pubKey, sig []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.Endpoint+"/api/v1/chunks/"+hash,
+		chunk,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/octet-stream")
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+
+	return c.doOp("upload", req)
+}
+
+func (c *Client) doFinalize(ctx context.Context, manifest Manifest, idemKey string, token, pubKey, sig []byte) ([]byte, error) {
+	reqJson, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.Endpoint+"/api/v1/manifests",
+		bytes.NewBuffer(reqJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+	req.Header.Add("Idempotency-Key", idemKey)
+
+	return c.doOp("upload", req)
+}
+
+// UploadChunked uploads a parcel of the given size in ChunkSize pieces, each
+// authorized with its own upload op. Progress is kept in a journal at
+// journalPath; calling UploadChunked again with the same data and journal
+// after a failure only sends the chunks that did not make it. The journal is
+// removed once the manifest has been accepted. Each chunk and the manifest
+// are retried on their own, and a chunk the server no longer has when the
+// manifest comes is sent again.
+func (c *Client) UploadChunked(ctx context.Context, data io.ReaderAt, size int64, signer keys.Signer, journalPath string) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("Empty parcel")
+	}
+	j, err := newUploadJournal(data, size)
+	if err != nil {
+		return nil, err
+	}
+	j = loadUploadJournal(journalPath, j)
+	err = j.save(journalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Owner:     signer.GetAddress(),
+		Metadata:  []byte(`{"owner":"` + signer.GetAddress() + `"}`),
+		Hash:      j.Hash,
+		Size:      j.Size,
+		ChunkSize: j.ChunkSize,
+		Chunks:    j.Chunks,
+	}
+	resent := map[string]bool{}
+	var ret []byte
+	for {
+		err = c.uploadChunks(ctx, data, size, signer, j, journalPath)
+		if err != nil {
+			return nil, err
+		}
+		ret, err = c.finalize(ctx, manifest, signer)
+		// the server may have lost chunks journaled as done, e.g. collected
+		// them as stale, so send each of those once more
+		hash, ok := missingChunk(err)
+		if !ok || resent[hash] {
+			break
+		}
+		resent[hash] = true
+		for i := range j.Chunks {
+			if j.Chunks[i] == hash {
+				j.Done[i] = false
+			}
+		}
+		err = j.save(journalPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(journalPath)
+
+	return ret, nil
+}
+
+// uploadChunks sends the chunks the journal does not have as done, marking
+// each done as it goes.
+func (c *Client) uploadChunks(ctx context.Context, data io.ReaderAt, size int64, signer keys.Signer, j *UploadJournal, journalPath string) error {
+	for i, hash := range j.Chunks {
+		if j.Done[i] {
+			continue
+		}
+		off := int64(i) * j.ChunkSize
+		err := c.retry(ctx, func() error {
+			authToken, sig, err := c.authorize(ctx, "upload", hash, signer)
+			if err != nil {
+				return err
+			}
+			chunk := io.NewSectionReader(data, off, chunkLen(off, size))
+			_, err = c.doUploadChunk(ctx, hash, chunk, authToken, signer.PublicKey(), sig)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		j.Done[i] = true
+		err = j.save(journalPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finalize sends the manifest with its own retries.
+func (c *Client) finalize(ctx context.Context, manifest Manifest, signer keys.Signer) ([]byte, error) {
+	idemKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	var ret []byte
+	err = c.retry(ctx, func() error {
+		authToken, sig, err := c.authorize(ctx, "upload", manifest.Hash, signer)
+		if err != nil {
+			return err
+		}
+		ret, err = c.doFinalize(ctx, manifest, idemKey, authToken, signer.PublicKey(), sig)
+		return err
+	})
+
+	return ret, err
+}
+
+func UploadChunked(ctx context.Context, data io.ReaderAt, size int64, signer keys.Signer, journalPath string) ([]byte, error) {
+	return DefaultClient.UploadChunked(ctx, data, size, signer, journalPath)
+}
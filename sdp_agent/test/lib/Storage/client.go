@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// RetryPolicy says how often and how patiently a storage operation is tried
+// again when the storage cannot be reached or cannot serve it for the time
+// being. Refusals, such as a missing grant, are never retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; 1 or less means no retry
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled for each one
+	// after, up to MaxDelay. Half of each wait is random, so that the boxes
+	// of a corridor coming back from the same outage do not retry in step.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+const (
+	DefaultEndpoint = "http://localhost:5000"
+	DefaultTimeout  = 30 * time.Second
+)
+
+// AuthBody asks the storage for an auth token for an operation.
+type AuthBody struct {
+	User      string          `json:"user"`
+	Operation json.RawMessage `json:"operation"`
+}
+
+// getOp returns the operation descriptor a token is requested for.
+func getOp(opName string, opArg string) (string, error) {
+	switch opName {
+	case "upload":
+		return `{"name":"upload","hash":"` + opArg + `"}`, nil
+	case "download":
+		return `{"name":"download","id":"` + opArg + `"}`, nil
+	case "remove":
+		return `{"name":"remove","id":"` + opArg + `"}`, nil
+	}
+	return "", errors.New("Unknown operation")
+}
+
+// Client talks to one storage. Each operation requests its own auth token,
+// so a retry runs the token challenge again as well.
+type Client struct {
+	Endpoint string
+	// Timeout bounds the wait for the response to each attempt, from when
+	// the request body is sent to when the response headers are in, so that
+	// big parcels can stream both ways on a slow link. Zero means no limit.
+	Timeout time.Duration
+	Retry   RetryPolicy
+	// Transport defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+func NewClient(endpoint string) *Client {
+	return &Client{
+		Endpoint: endpoint,
+		Timeout:  DefaultTimeout,
+		Retry:    DefaultRetryPolicy,
+	}
+}
+
+// DefaultClient serves the package level functions. Point it elsewhere by
+// setting DefaultClient.Endpoint.
+var DefaultClient = NewClient(DefaultEndpoint)
+
+// doStream runs a storage API call, with Timeout bounding the wait for the
+// response but neither sending the request body nor reading the response
+// body. The caller owns the returned body and must close it.
+func (c *Client) doStream(op string, req *http.Request) (io.ReadCloser, error) {
+	client := &http.Client{Transport: c.Transport}
+	if c.Timeout <= 0 {
+		return doHTTPStream(op, client, req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+
+	// the timer starts once the body is sent, or right away without one
+	var sent sync.Once
+	var timer *time.Timer
+	start := func() {
+		sent.Do(func() { timer = time.AfterFunc(c.Timeout, cancel) })
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		start()
+	} else {
+		req.Body = &sentNotifier{req.Body, start}
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return &sentNotifier{body, start}, nil
+			}
+		}
+	}
+
+	body, err := doHTTPStream(op, client, req)
+	// no timer is started after this
+	sent.Do(func() {})
+	if timer != nil && !timer.Stop() && err != nil {
+		// cut off by the timer rather than by the caller
+		err = &url.Error{Op: req.Method, URL: req.URL.String(), Err: errTimeout}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &cancelOnClose{body, cancel}, nil
+}
+
+// doOp runs a storage API call and reads the response into memory.
+func (c *Client) doOp(op string, req *http.Request) ([]byte, error) {
+	body, err := c.doStream(op, req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
+// sentNotifier calls sent once the request body has been read through.
+type sentNotifier struct {
+	io.ReadCloser
+	sent func()
+}
+
+func (r *sentNotifier) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.sent()
+	}
+	return n, err
+}
+
+// cancelOnClose releases the context of a call once its response is read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// delay returns the wait before retry n, counting from 1.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay << uint(n-1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(mrand.Int63n(int64(d/2)+1))
+}
+
+// retry runs attempt until it succeeds, fails for good, runs out of
+// attempts or ctx is done.
+func (c *Client) retry(ctx context.Context, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || !IsUnavailable(err) || n >= c.Retry.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(c.Retry.delay(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newIdempotencyKey returns a key that marks the attempts of one upload or
+// removal as the same, so that the storage does it once when an attempt that
+// went through is retried because its response was lost.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestToken asks for the token to sign for op. A refusal comes back as a
+// StorageError for the operation itself.
+func (c *Client) requestToken(ctx context.Context, opName, user, op string) ([]byte, error) {
+	if !json.Valid([]byte(op)) {
+		return nil, errors.New("Malformed op")
+	}
+	b, err := json.Marshal(AuthBody{user, json.RawMessage(op)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.Endpoint+"/api/v1/auth",
+		bytes.NewBuffer(b),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	rsp, err := c.doOp(opName, req)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Token string `json:"token"`
+	}
+	err = json.Unmarshal(rsp, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(res.Token), nil
+}
+
+// authorize runs the token challenge for a single storage operation.
+func (c *Client) authorize(ctx context.Context, opName, opArg string, signer keys.Signer) ([]byte, []byte, error) {
+	op, err := getOp(opName, opArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	authToken, err := c.requestToken(ctx, opName, signer.GetAddress(), op)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := signer.Sign(authToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authToken, sig, nil
+}
+
+// countingWriter tells whether a failed download already wrote anything,
+// in which case it cannot be tried again into the same writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
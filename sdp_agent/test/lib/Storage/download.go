@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/amolabs/amo-client-go/lib/envelope"
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// maxErrorBody caps how much of an error response is read into memory.
+const maxErrorBody = 4096
+
+// doHTTPStream runs a storage API call whose response should not be read
+// into memory. The caller owns the returned body and must close it. A refusal
+// comes back as a StorageError for op.
+func doHTTPStream(op string, client *http.Client, req *http.Request) (io.ReadCloser, error) {
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode >= 300 {
+		defer rsp.Body.Close()
+		return nil, newStorageError(op, rsp)
+	}
+
+	return rsp.Body, nil
+}
+
+func (c *Client) doDownloadTo(ctx context.Context, id string, w io.Writer, token, pubKey, sig []byte) (int64, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		c.Endpoint+"/api/v1/parcels/"+id,
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+
+	body, err := c.doStream("download", req)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	return io.Copy(w, body)
+}
+
+func (c *Client) doDownload(ctx context.Context, id string, token, pubKey, sig []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.doDownloadTo(ctx, id, &buf, token, pubKey, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DownloadTo streams a parcel into w and returns the number of bytes written.
+// A failed attempt is retried only if it wrote nothing to w yet.
+func (c *Client) DownloadTo(ctx context.Context, parcelID string, w io.Writer, signer keys.Signer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := c.retry(ctx, func() error {
+		authToken, sig, err := c.authorize(ctx, "download", parcelID, signer)
+		if err != nil {
+			return err
+		}
+		_, err = c.doDownloadTo(ctx, parcelID, cw, authToken, signer.PublicKey(), sig)
+		if err != nil && cw.n > 0 {
+			// not to be retried
+			return errors.New("Download cut off after " +
+				strconv.FormatInt(cw.n, 10) + " bytes: " + err.Error())
+		}
+		return err
+	})
+
+	return cw.n, err
+}
+
+func DownloadTo(ctx context.Context, parcelID string, w io.Writer, signer keys.Signer) (int64, error) {
+	return DefaultClient.DownloadTo(ctx, parcelID, w, signer)
+}
+
+func (c *Client) Download(ctx context.Context, parcelID string, signer keys.Signer) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.DownloadTo(ctx, parcelID, &buf, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func Download(ctx context.Context, parcelID string, signer keys.Signer) ([]byte, error) {
+	return DefaultClient.Download(ctx, parcelID, signer)
+}
+
+// DownloadDecrypted downloads an encrypted parcel and writes the plain data to
+// w, using the data key in custody, which must have been issued to key. On
+// error, whatever was already written to w must be discarded.
+func (c *Client) DownloadDecrypted(ctx context.Context, parcelID string, w io.Writer, custody []byte, key keys.KeyEntry) error {
+	dataKey, err := envelope.OpenCustody(custody, &key)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := c.DownloadTo(ctx, parcelID, pw, &key)
+		pw.CloseWithError(err)
+	}()
+	err = envelope.Decrypt(w, pr, dataKey)
+	pr.CloseWithError(err)
+
+	return err
+}
+
+func DownloadDecrypted(ctx context.Context, parcelID string, w io.Writer, custody []byte, key keys.KeyEntry) error {
+	return DefaultClient.DownloadDecrypted(ctx, parcelID, w, custody, key)
+}
@@ -0,0 +1,92 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/storage"
+	"github.com/amolabs/amo-client-go/lib/storage/server"
+)
+
+func parcelID(t *testing.T, rsp []byte) string {
+	var res struct {
+		Id string `json:"id"`
+	}
+	assert.NoError(t, json.Unmarshal(rsp, &res))
+	return res.Id
+}
+
+// TestEdgeServer runs the client against the local storage server.
+func TestEdgeServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := server.New(filepath.Join(dir, "store"))
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := storage.NewClient(ts.URL)
+	c.Retry.MaxAttempts = 1
+
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	other, _ := keys.GenerateKey("other", nil, false)
+	data := bytes.Repeat([]byte("parcel "), 1000)
+
+	rsp, err := c.Upload(context.Background(), data, owner)
+	assert.NoError(t, err)
+	id := parcelID(t, rsp)
+
+	// uploading again gives the same parcel
+	rsp2, err := c.Upload(context.Background(), data, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, rsp, rsp2)
+
+	meta, err := c.Inspect(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"`+owner.Address+`"}`, string(meta))
+
+	got, err := c.Download(context.Background(), id, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	_, err = c.Download(context.Background(), id, other)
+	assert.True(t, storage.IsUnauthorized(err))
+	_, err = c.Remove(context.Background(), id, other)
+	assert.True(t, storage.IsUnauthorized(err))
+
+	_, err = c.Remove(context.Background(), id, owner)
+	assert.NoError(t, err)
+	_, err = c.Download(context.Background(), id, owner)
+	assert.True(t, storage.IsNotFound(err))
+
+	// granted downloads
+	s.CanDownload = func(user string, p *server.Parcel) bool {
+		return user == other.Address
+	}
+	_, err = c.Upload(context.Background(), data, owner)
+	assert.NoError(t, err)
+	got, err = c.Download(context.Background(), id, other)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// chunked
+	big := bytes.Repeat([]byte("chunked parcel "), 1<<16)
+	rsp, err = c.UploadChunked(context.Background(), bytes.NewReader(big), int64(len(big)), owner,
+		filepath.Join(dir, "journal"))
+	assert.NoError(t, err)
+	id = parcelID(t, rsp)
+	var buf bytes.Buffer
+	n, err := c.DownloadTo(context.Background(), id, &buf, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(big)), n)
+	assert.Equal(t, big, buf.Bytes())
+}
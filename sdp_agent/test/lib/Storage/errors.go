@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// StorageError is a storage API call refused by the server, as opposed to
+// one that never got an answer.
+type StorageError struct {
+	// upload, download, remove or inspect
+	Op         string
+	StatusCode int
+	// the error the server gave, or the whole body when it is not JSON
+	Message string
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("Storage %s failed with %d %s: %s",
+		e.Op, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newStorageError reads the error out of a response the server refused.
+func newStorageError(op string, rsp *http.Response) error {
+	body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxErrorBody))
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &res) == nil && len(res.Error) > 0 {
+		msg = res.Error
+	}
+
+	return &StorageError{Op: op, StatusCode: rsp.StatusCode, Message: msg}
+}
+
+func statusOf(err error) int {
+	var e *StorageError
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsUnauthorized tells whether the server refused the caller, e.g. for want
+// of a grant on the parcel.
+func IsUnauthorized(err error) bool {
+	status := statusOf(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+func IsNotFound(err error) bool {
+	return statusOf(err) == http.StatusNotFound
+}
+
+// missingChunk returns the chunk a manifest was refused for not having.
+func missingChunk(err error) (string, bool) {
+	var e *StorageError
+	if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest ||
+		!strings.HasPrefix(e.Message, "Missing chunk ") {
+		return "", false
+	}
+	return strings.TrimPrefix(e.Message, "Missing chunk "), true
+}
+
+// IsUnavailable tells whether the server could not be reached or could not
+// serve the call, so that it may succeed later as is: the call timed out, the
+// connection was refused or reset, or a gateway in front of the storage
+// answered for it. Anything else, like a malformed endpoint, is for good.
+func IsUnavailable(err error) bool {
+	switch statusOf(err) {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// outcomeUnknown tells whether a call that was sent may have been carried
+// out with its response lost: it timed out, the connection was reset, or a
+// gateway gave up waiting for the storage. A refused connection or a storage
+// that said it is unavailable did nothing.
+func outcomeUnknown(err error) bool {
+	switch statusOf(err) {
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// timeoutError is a call cut off by the client timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Timed out awaiting the response" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errTimeout net.Error = timeoutError{}
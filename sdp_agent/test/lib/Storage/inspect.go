@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+)
+
+func (c *Client) doInspect(ctx context.Context, id string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		c.Endpoint+"/api/v1/parcels/"+id+"?key=metadata",
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doOp("inspect", req)
+}
+
+func (c *Client) Inspect(ctx context.Context, parcelID string) ([]byte, error) {
+	var ret []byte
+	err := c.retry(ctx, func() error {
+		var err error
+		ret, err = c.doInspect(ctx, parcelID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func Inspect(ctx context.Context, parcelID string) ([]byte, error) {
+	return DefaultClient.Inspect(ctx, parcelID)
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// MultisigAuth is a storage operation on a co-owned parcel, waiting for the
+// approval of enough co-owners. It marshals to JSON, so that it can be
+// passed from one co-owner to the next. When all co-owners are at hand a
+// keys.MultisigSigner does the same in one go, with the plain Remove.
+type MultisigAuth struct {
+	OpName   string             `json:"op_name"`
+	OpArg    string             `json:"op_arg"`
+	Account  []byte             `json:"account"`
+	Token    []byte             `json:"token"`
+	Partials []*keys.PartialSig `json:"partials"`
+}
+
+// NewMultisigAuth runs the token challenge for the multisig account.
+func (c *Client) NewMultisigAuth(ctx context.Context, opName, opArg string, m *keys.Multisig) (*MultisigAuth, error) {
+	op, err := getOp(opName, opArg)
+	if err != nil {
+		return nil, err
+	}
+	authToken, err := c.requestToken(ctx, opName, m.Address(), op)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultisigAuth{
+		OpName:  opName,
+		OpArg:   opArg,
+		Account: m.Encode(),
+		Token:   authToken,
+	}, nil
+}
+
+func NewMultisigAuth(ctx context.Context, opName, opArg string, m *keys.Multisig) (*MultisigAuth, error) {
+	return DefaultClient.NewMultisigAuth(ctx, opName, opArg, m)
+}
+
+func (a *MultisigAuth) multisig() (*keys.Multisig, error) {
+	return keys.DecodeMultisig(a.Account)
+}
+
+// Approve adds the partial signature of a co-owner.
+func (a *MultisigAuth) Approve(signer keys.Signer) error {
+	m, err := a.multisig()
+	if err != nil {
+		return err
+	}
+	p, err := m.SignPartial(signer, a.Token)
+	if err != nil {
+		return err
+	}
+
+	return a.Add(p)
+}
+
+// Add adds a partial signature made elsewhere, once it checks out.
+func (a *MultisigAuth) Add(p *keys.PartialSig) error {
+	m, err := a.multisig()
+	if err != nil {
+		return err
+	}
+	err = m.VerifyPartial(a.Token, p)
+	if err != nil {
+		return err
+	}
+	for _, q := range a.Partials {
+		if bytes.Equal(q.PubKey, p.PubKey) {
+			return errors.New("Already approved by " + keys.DeriveAddress(p.PubKey))
+		}
+	}
+	a.Partials = append(a.Partials, p)
+
+	return nil
+}
+
+// Approved tells whether enough co-owners have approved.
+func (a *MultisigAuth) Approved() bool {
+	_, err := a.signature()
+	return err == nil
+}
+
+func (a *MultisigAuth) signature() ([]byte, error) {
+	m, err := a.multisig()
+	if err != nil {
+		return nil, err
+	}
+	return m.Combine(a.Token, a.Partials)
+}
+
+// RemoveApproved removes a co-owned parcel once enough co-owners approved.
+// It is not retried, as the token the co-owners signed is good for one try.
+func (c *Client) RemoveApproved(ctx context.Context, a *MultisigAuth) ([]byte, error) {
+	if a.OpName != "remove" {
+		return nil, errors.New("Not approved for remove but for " + a.OpName)
+	}
+	sig, err := a.signature()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRemove(ctx, a.OpArg, "", a.Token, a.Account, sig)
+}
+
+func RemoveApproved(ctx context.Context, a *MultisigAuth) ([]byte, error) {
+	return DefaultClient.RemoveApproved(ctx, a)
+}
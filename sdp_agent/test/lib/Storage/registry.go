@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/amolabs/amo-client-go/lib/rpc"
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+var ErrInactive = errors.New("Storage is not active")
+
+// Registry keeps a client for each storage in use, resolving storage IDs to
+// their URLs from the storage records on chain. The record is looked up on
+// every call, so that a storage the chain deactivates is refused right away;
+// put an rpc.Cache in front of the chain to spare the queries.
+type Registry struct {
+	// Template gives the timeouts and retry policy of the clients.
+	Template Client
+
+	mtx     sync.Mutex
+	clients map[string]*Client
+}
+
+func NewRegistry(template *Client) *Registry {
+	return &Registry{
+		Template: *template,
+		clients:  map[string]*Client{},
+	}
+}
+
+func (r *Registry) resolve(ctx context.Context, storageID string) (*types.Storage, *Client, error) {
+	storage, err := rpc.GetStorage(ctx, storageID)
+	if err == rpc.ErrNotFound {
+		return nil, nil, errors.New("No storage " + storageID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !storage.Active {
+		return nil, nil, ErrInactive
+	}
+	url := strings.TrimRight(storage.Url, "/")
+	if len(url) == 0 {
+		return nil, nil, errors.New("No URL for storage " + storageID)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	c := r.clients[storageID]
+	if c == nil || c.Endpoint != url {
+		c = new(Client)
+		*c = r.Template
+		c.Endpoint = url
+		r.clients[storageID] = c
+	}
+
+	return storage, c, nil
+}
+
+// Client returns the client for a storage, unless the storage is inactive.
+func (r *Registry) Client(ctx context.Context, storageID string) (*Client, error) {
+	_, c, err := r.resolve(ctx, storageID)
+	return c, err
+}
+
+func amount(c *types.Currency) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(c.String(), 10)
+	if !ok {
+		return nil, errors.New("Malformed amount " + c.String())
+	}
+	return n, nil
+}
+
+// Cheapest picks the active storage out of storageIDs that costs the least
+// to upload to, counting the registration fee and the hosting fee together,
+// and returns its ID and client. Storages that are inactive or cannot be
+// looked up are passed over; the first of equally cheap ones is taken.
+func (r *Registry) Cheapest(ctx context.Context, storageIDs ...string) (string, *Client, error) {
+	var (
+		bestID    string
+		bestPrice *big.Int
+		best      *Client
+		lastErr   error
+	)
+	for _, id := range storageIDs {
+		storage, c, err := r.resolve(ctx, id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		regFee, err := amount(&storage.RegistrationFee)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		hostFee, err := amount(&storage.HostingFee)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		price := regFee.Add(regFee, hostFee)
+		if best == nil || price.Cmp(bestPrice) < 0 {
+			bestID, bestPrice, best = id, price, c
+		}
+	}
+	if best == nil {
+		if lastErr == nil {
+			lastErr = errors.New("No storage to choose from")
+		}
+		return "", nil, lastErr
+	}
+
+	return bestID, best, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+func (c *Client) doRemove(ctx context.Context, id, idemKey string, token, pubKey, sig []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"DELETE",
+		c.Endpoint+"/api/v1/parcels/"+id,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+	if len(idemKey) > 0 {
+		req.Header.Add("Idempotency-Key", idemKey)
+	}
+
+	return c.doOp("remove", req)
+}
+
+// Remove removes a parcel. All attempts carry the same idempotency key. A
+// parcel found missing on a retry counts as removed only when an earlier
+// DELETE went out and its outcome is unknown, as that attempt is likely to
+// have gone through with its response lost.
+func (c *Client) Remove(ctx context.Context, parcelID string, signer keys.Signer) ([]byte, error) {
+	idemKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []byte
+	maybeRemoved := false
+	err = c.retry(ctx, func() error {
+		authToken, sig, err := c.authorize(ctx, "remove", parcelID, signer)
+		if err != nil {
+			return err
+		}
+		ret, err = c.doRemove(ctx, parcelID, idemKey, authToken, signer.PublicKey(), sig)
+		if maybeRemoved && IsNotFound(err) {
+			return nil
+		}
+		if outcomeUnknown(err) {
+			maybeRemoved = true
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func Remove(ctx context.Context, parcelID string, signer keys.Signer) ([]byte, error) {
+	return DefaultClient.Remove(ctx, parcelID, signer)
+}
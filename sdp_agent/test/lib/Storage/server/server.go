@@ -0,0 +1,601 @@
+// Package server is a storage server for the parcels API the storage client
+// talks to, keeping parcels in a local directory. It lets an RSU run an edge
+// cache of its own, and tests run against the real protocol.
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amolabs/amo-client-go/lib/storage"
+)
+
+const (
+	DefaultTokenTTL = time.Minute
+	// DefaultChunkTTL is how long chunks are kept unless set otherwise.
+	DefaultChunkTTL = 24 * time.Hour
+	// DefaultMaxParcelSize caps uploads unless set otherwise.
+	DefaultMaxParcelSize = 64 << 20
+	// maxBodyOverhead is what a JSON upload body may take on top of the hex
+	// of the parcel.
+	maxBodyOverhead = 64 << 10
+)
+
+// op is the operation an auth token is asked for, as the client's getOp
+// writes it.
+type op struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+func (o op) String() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func parseOp(b []byte) (op, error) {
+	var o op
+	err := json.Unmarshal(b, &o)
+	if err != nil {
+		return o, err
+	}
+	switch o.Name {
+	case "upload":
+		if !validDigest(o.Hash) {
+			return o, errBadDigest
+		}
+		return op{Name: o.Name, Hash: o.Hash}, nil
+	case "download", "remove":
+		if len(o.ID) == 0 {
+			return o, errors.New("No parcel id")
+		}
+		return op{Name: o.Name, ID: o.ID}, nil
+	}
+	return o, errors.New("Unknown operation")
+}
+
+// Server serves the parcels API. Parcel IDs are the hex sha256 of the
+// parcel data, so uploading the same parcel again, as a retry does, gives
+// back the same parcel.
+type Server struct {
+	// MaxParcelSize caps uploads; New sets it to DefaultMaxParcelSize.
+	MaxParcelSize int64
+	// ChunkTTL is how long a chunk is kept after it was last uploaded, for
+	// the upload to be finalized or resumed. New sets it to DefaultChunkTTL.
+	ChunkTTL time.Duration
+	// CanDownload tells whether user, who is not the owner, may download a
+	// parcel, say by the usages granted on chain. With nil, only owners can.
+	CanDownload func(user string, p *Parcel) bool
+
+	// Verifier issues and checks the auth tokens; set its TTL to change how
+	// long a token may wait to be used.
+	Verifier *storage.Verifier
+
+	store *store
+	mux   *http.ServeMux
+}
+
+// New returns a server keeping its parcels under dir.
+func New(dir string) (*Server, error) {
+	st, err := openStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		MaxParcelSize: DefaultMaxParcelSize,
+		ChunkTTL:      DefaultChunkTTL,
+		Verifier:      storage.NewVerifier(DefaultTokenTTL),
+		store:         st,
+		mux:           http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/v1/auth", s.handleAuth)
+	s.mux.HandleFunc("/api/v1/parcels", s.handleUpload)
+	s.mux.HandleFunc("/api/v1/parcels/", s.handleParcel)
+	s.mux.HandleFunc("/api/v1/chunks/", s.handleChunk)
+	s.mux.HandleFunc("/api/v1/manifests", s.handleManifest)
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// ListenAndServe serves on addr, collecting old chunks as it goes.
+func (s *Server) ListenAndServe(addr string) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	if s.ChunkTTL > 0 {
+		go func() {
+			ticker := time.NewTicker(s.ChunkTTL / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.CollectChunks()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return http.ListenAndServe(addr, s)
+}
+
+// CollectChunks removes the chunks older than ChunkTTL and returns how many
+// it removed. ListenAndServe calls it every half ChunkTTL; a server run
+// otherwise must call it itself.
+func (s *Server) CollectChunks() (int, error) {
+	return s.store.sweepChunks(time.Now().Add(-s.ChunkTTL))
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, 405, "Expected POST method")
+		return
+	}
+	var body struct {
+		User      string          `json:"user"`
+		Operation json.RawMessage `json:"operation"`
+	}
+	err := json.NewDecoder(io.LimitReader(req.Body, 4096)).Decode(&body)
+	if err != nil || len(body.User) == 0 || len(body.Operation) == 0 {
+		writeError(w, 400, "Malformed request body")
+		return
+	}
+	o, err := parseOp(body.Operation)
+	if err != nil {
+		writeError(w, 400, "Malformed operation: "+err.Error())
+		return
+	}
+	// the client is told apart by its address, not the user it claims to be
+	client, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		client = req.RemoteAddr
+	}
+	token, err := s.Verifier.Issue(client, strings.ToUpper(body.User), o.String())
+	if err == storage.ErrTooManyTokens {
+		writeError(w, 429, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+
+	writeJSON(w, struct {
+		Token string `json:"token"`
+	}{token})
+}
+
+// credentials are the signed token a request carries in its headers.
+type credentials struct {
+	token  string
+	pubKey []byte
+	sig    []byte
+}
+
+// readCredentials takes the signed token off the request headers, or writes
+// the refusal and returns false. It does not read the body, so that an
+// anonymous request is turned away before its body is taken in.
+func readCredentials(w http.ResponseWriter, req *http.Request) (*credentials, bool) {
+	token := req.Header.Get("X-Auth-Token")
+	if len(token) == 0 {
+		writeError(w, 401, "X-Auth-Token header missing")
+		return nil, false
+	}
+	pubKey, err := hex.DecodeString(req.Header.Get("X-Public-Key"))
+	if err != nil || len(pubKey) == 0 {
+		writeError(w, 401, "X-Public-Key header missing or malformed")
+		return nil, false
+	}
+	sig, err := hex.DecodeString(req.Header.Get("X-Signature"))
+	if err != nil || len(sig) == 0 {
+		writeError(w, 401, "X-Signature header missing or malformed")
+		return nil, false
+	}
+
+	return &credentials{token: token, pubKey: pubKey, sig: sig}, true
+}
+
+// verify checks the credentials for want and returns the user, or writes
+// the refusal and returns false.
+func (s *Server) verify(w http.ResponseWriter, cred *credentials, want op) (string, bool) {
+	c, err := s.Verifier.Verify(cred.token, cred.pubKey, cred.sig)
+	if err != nil {
+		writeError(w, 401, err.Error())
+		return "", false
+	}
+	if c.Operation != want.String() {
+		writeError(w, 401, "Token is for another operation")
+		return "", false
+	}
+
+	return c.User, true
+}
+
+// authenticate checks the signed token of a request for want and returns
+// the user, or writes the refusal and returns false.
+func (s *Server) authenticate(w http.ResponseWriter, req *http.Request, want op) (string, bool) {
+	cred, ok := readCredentials(w, req)
+	if !ok {
+		return "", false
+	}
+	return s.verify(w, cred, want)
+}
+
+// limit caps the request body at n bytes.
+func limit(w http.ResponseWriter, req *http.Request, n int64) {
+	req.Body = http.MaxBytesReader(w, req.Body, n)
+}
+
+// tooLarge tells whether err comes from reading past the limit.
+func tooLarge(err error) bool {
+	var e *http.MaxBytesError
+	return errors.As(err, &e)
+}
+
+// upload form fields, as the client sends them
+type uploadBody struct {
+	Owner    string          `json:"owner"`
+	Metadata json.RawMessage `json:"metadata"`
+	Data     string          `json:"data"`
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, 405, "Expected POST method")
+		return
+	}
+	cred, ok := readCredentials(w, req)
+	if !ok {
+		return
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		limit(w, req, s.MaxParcelSize+maxBodyOverhead)
+		s.handleUploadStream(w, req, cred)
+		return
+	}
+
+	// the data is hex, twice the size of the parcel
+	limit(w, req, 2*s.MaxParcelSize+maxBodyOverhead)
+	var body uploadBody
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if tooLarge(err) {
+		writeError(w, 413, "Parcel too large")
+		return
+	}
+	if err != nil {
+		writeError(w, 400, "Malformed request body")
+		return
+	}
+	data, err := hex.DecodeString(body.Data)
+	if err != nil {
+		writeError(w, 400, "Malformed data")
+		return
+	}
+	hash := sha256Hex(data)
+	user, ok := s.verify(w, cred, op{Name: "upload", Hash: hash})
+	if !ok {
+		return
+	}
+	n, err := s.store.put("blobs", hash, bytes.NewReader(data))
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	s.addParcel(w, user, body.Owner, body.Metadata, hash, n)
+}
+
+// handleUploadStream takes the parcel as the multipart stream of the client,
+// with the owner and metadata parts ahead of the data, which is named by
+// its hash.
+func (s *Server) handleUploadStream(w http.ResponseWriter, req *http.Request, cred *credentials) {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		writeError(w, 400, "Malformed multipart body")
+		return
+	}
+	var owner string
+	var metadata json.RawMessage
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeError(w, 400, "No data part")
+			return
+		}
+		if err != nil {
+			writeError(w, 400, "Malformed multipart body")
+			return
+		}
+		switch part.FormName() {
+		case "owner":
+			owner, err = readField(part)
+		case "metadata":
+			var v string
+			v, err = readField(part)
+			metadata = json.RawMessage(v)
+		case "data":
+			s.putUpload(w, cred, part, owner, metadata)
+			return
+		}
+		if err != nil {
+			writeError(w, 400, "Malformed multipart body")
+			return
+		}
+	}
+}
+
+func readField(part *multipart.Part) (string, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(part, 4096))
+	return string(b), err
+}
+
+func (s *Server) putUpload(w http.ResponseWriter, cred *credentials, data *multipart.Part, owner string, metadata json.RawMessage) {
+	hash := data.FileName()
+	user, ok := s.verify(w, cred, op{Name: "upload", Hash: hash})
+	if !ok {
+		return
+	}
+	if strings.ToUpper(owner) != user {
+		writeError(w, 403, "Owner is not the uploader")
+		return
+	}
+	n, err := s.store.put("blobs", hash, data)
+	if tooLarge(err) {
+		writeError(w, 413, "Parcel too large")
+		return
+	}
+	if err == errBadHash {
+		writeError(w, 400, "Hash mismatch")
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	s.addParcel(w, user, owner, metadata, hash, n)
+}
+
+func (s *Server) addParcel(w http.ResponseWriter, user, owner string, metadata json.RawMessage, hash string, size int64) {
+	if strings.ToUpper(owner) != user {
+		writeError(w, 403, "Owner is not the uploader")
+		return
+	}
+	if len(metadata) == 0 {
+		metadata = json.RawMessage(`{}`)
+	}
+	if !json.Valid(metadata) {
+		writeError(w, 400, "Metadata is not JSON")
+		return
+	}
+	p, err := s.store.addParcel(&Parcel{
+		ID:       hash,
+		Owner:    user,
+		Metadata: metadata,
+		Hash:     hash,
+		Size:     size,
+	})
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	if p.Owner != user {
+		writeError(w, 409, "Parcel already uploaded by another owner")
+		return
+	}
+
+	writeJSON(w, struct {
+		ID string `json:"id"`
+	}{p.ID})
+}
+
+func (s *Server) handleParcel(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/api/v1/parcels/")
+	switch req.Method {
+	case "GET":
+		if key := req.URL.Query().Get("key"); len(key) > 0 {
+			s.handleInspect(w, id, key)
+			return
+		}
+		s.handleDownload(w, req, id)
+	case "DELETE":
+		s.handleRemove(w, req, id)
+	default:
+		writeError(w, 405, "Expected GET or DELETE method")
+	}
+}
+
+func (s *Server) handleInspect(w http.ResponseWriter, id, key string) {
+	if key != "metadata" {
+		writeError(w, 400, "Unknown query key")
+		return
+	}
+	p, err := s.store.getParcel(id)
+	if err == errNotFound {
+		writeError(w, 404, "Parcel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(p.Metadata)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, req *http.Request, id string) {
+	user, ok := s.authenticate(w, req, op{Name: "download", ID: id})
+	if !ok {
+		return
+	}
+	p, err := s.store.getParcel(id)
+	if err == errNotFound {
+		writeError(w, 404, "Parcel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	if p.Owner != user && (s.CanDownload == nil || !s.CanDownload(user, p)) {
+		writeError(w, 403, "Parcel not granted")
+		return
+	}
+	f, err := s.store.open("blobs", p.Hash)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(p.Size, 10))
+	io.Copy(w, f)
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, req *http.Request, id string) {
+	user, ok := s.authenticate(w, req, op{Name: "remove", ID: id})
+	if !ok {
+		return
+	}
+	p, err := s.store.getParcel(id)
+	if err == errNotFound {
+		writeError(w, 404, "Parcel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	if p.Owner != user {
+		writeError(w, 403, "Only the owner can remove a parcel")
+		return
+	}
+	err = s.store.removeParcel(id)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+}
+
+func (s *Server) handleChunk(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, 405, "Expected POST method")
+		return
+	}
+	hash := strings.TrimPrefix(req.URL.Path, "/api/v1/chunks/")
+	_, ok := s.authenticate(w, req, op{Name: "upload", Hash: hash})
+	if !ok {
+		return
+	}
+	limit(w, req, s.MaxParcelSize)
+	_, err := s.store.put("chunks", hash, req.Body)
+	if tooLarge(err) {
+		writeError(w, 413, "Chunk too large")
+		return
+	}
+	if err == errBadHash {
+		writeError(w, 400, "Hash mismatch")
+		return
+	}
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+
+	writeJSON(w, struct {
+		Hash string `json:"hash"`
+	}{hash})
+}
+
+// manifest finalizes a chunked upload, as the client's Manifest.
+type manifest struct {
+	Owner     string          `json:"owner"`
+	Metadata  json.RawMessage `json:"metadata"`
+	Hash      string          `json:"hash"`
+	Size      int64           `json:"size"`
+	ChunkSize int64           `json:"chunk_size"`
+	Chunks    []string        `json:"chunks"`
+}
+
+func (s *Server) handleManifest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, 405, "Expected POST method")
+		return
+	}
+	cred, ok := readCredentials(w, req)
+	if !ok {
+		return
+	}
+	var m manifest
+	err := json.NewDecoder(io.LimitReader(req.Body, 1<<20)).Decode(&m)
+	if err != nil || len(m.Chunks) == 0 {
+		writeError(w, 400, "Malformed request body")
+		return
+	}
+	user, ok := s.verify(w, cred, op{Name: "upload", Hash: m.Hash})
+	if !ok {
+		return
+	}
+	if strings.ToUpper(m.Owner) != user {
+		writeError(w, 403, "Owner is not the uploader")
+		return
+	}
+	if m.Size > s.MaxParcelSize {
+		writeError(w, 413, "Parcel too large")
+		return
+	}
+	// a manifest must not list more chunks than the parcel takes, or the
+	// same big chunk over and over could fill the disk
+	if m.Size <= 0 || m.ChunkSize <= 0 ||
+		int64(len(m.Chunks)) != (m.Size+m.ChunkSize-1)/m.ChunkSize {
+		writeError(w, 400, "Chunks do not add up to the size")
+		return
+	}
+	n, err := s.store.assemble(m.Hash, m.Chunks, m.Size)
+	if err == errBadHash {
+		writeError(w, 400, "Hash mismatch")
+		return
+	}
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	if n != m.Size {
+		writeError(w, 400, "Size mismatch")
+		return
+	}
+
+	s.addParcel(w, user, m.Owner, m.Metadata, m.Hash, n)
+}
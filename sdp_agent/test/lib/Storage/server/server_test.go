@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, func()) {
+	dir, err := ioutil.TempDir("", "storage-")
+	assert.NoError(t, err)
+	s, err := New(dir)
+	assert.NoError(t, err)
+	ts := httptest.NewServer(s)
+	return s, ts, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func call(t *testing.T, method, url string, body []byte, header map[string]string) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	assert.NoError(t, err)
+	return rsp.StatusCode, b
+}
+
+func token(t *testing.T, url, user, op string) string {
+	code, b := call(t, "POST", url+"/api/v1/auth",
+		[]byte(`{"user":"`+user+`","operation":`+op+`}`), nil)
+	assert.Equal(t, 200, code, string(b))
+	var res struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &res))
+	return res.Token
+}
+
+func signed(t *testing.T, key *keys.KeyEntry, token string) map[string]string {
+	sig, err := key.Sign([]byte(token))
+	assert.NoError(t, err)
+	return map[string]string{
+		"X-Auth-Token": token,
+		"X-Public-Key": hex.EncodeToString(key.PubKey),
+		"X-Signature":  hex.EncodeToString(sig),
+	}
+}
+
+func TestServer(t *testing.T) {
+	_, ts, done := newTestServer(t)
+	defer done()
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	other, _ := keys.GenerateKey("other", nil, false)
+
+	data := []byte("parcel data")
+	hash := sha256Hex(data)
+	uploadOp := `{"name":"upload","hash":"` + hash + `"}`
+	body, _ := json.Marshal(uploadBody{
+		Owner:    owner.Address,
+		Metadata: json.RawMessage(`{"owner":"` + owner.Address + `"}`),
+		Data:     hex.EncodeToString(data),
+	})
+
+	// no token
+	code, _ := call(t, "POST", ts.URL+"/api/v1/parcels", body, nil)
+	assert.Equal(t, 401, code)
+
+	// token signed by another key
+	tok := token(t, ts.URL, owner.Address, uploadOp)
+	code, _ = call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, other, tok))
+	assert.Equal(t, 401, code)
+	// the failed try used the token up
+	code, _ = call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 401, code)
+
+	// token for other data
+	tok = token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+sha256Hex([]byte("x"))+`"}`)
+	code, _ = call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 401, code)
+
+	tok = token(t, ts.URL, owner.Address, uploadOp)
+	code, b := call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 200, code, string(b))
+	assert.Equal(t, `{"id":"`+hash+`"}`, string(b))
+
+	// replay
+	code, _ = call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 401, code)
+
+	// the same data by another owner
+	body2, _ := json.Marshal(uploadBody{
+		Owner:    other.Address,
+		Metadata: json.RawMessage(`{}`),
+		Data:     hex.EncodeToString(data),
+	})
+	tok = token(t, ts.URL, other.Address, uploadOp)
+	code, _ = call(t, "POST", ts.URL+"/api/v1/parcels", body2, signed(t, other, tok))
+	assert.Equal(t, 409, code)
+
+	// inspect
+	code, b = call(t, "GET", ts.URL+"/api/v1/parcels/"+hash+"?key=metadata", nil, nil)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"owner":"`+owner.Address+`"}`, string(b))
+	code, _ = call(t, "GET", ts.URL+"/api/v1/parcels/"+sha256Hex(nil)+"?key=metadata", nil, nil)
+	assert.Equal(t, 404, code)
+
+	// download
+	downloadOp := `{"name":"download","id":"` + hash + `"}`
+	tok = token(t, ts.URL, other.Address, downloadOp)
+	code, _ = call(t, "GET", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, other, tok))
+	assert.Equal(t, 403, code)
+	tok = token(t, ts.URL, owner.Address, downloadOp)
+	code, b = call(t, "GET", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, owner, tok))
+	assert.Equal(t, 200, code)
+	assert.Equal(t, data, b)
+
+	// remove
+	removeOp := `{"name":"remove","id":"` + hash + `"}`
+	tok = token(t, ts.URL, other.Address, removeOp)
+	code, _ = call(t, "DELETE", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, other, tok))
+	assert.Equal(t, 403, code)
+	tok = token(t, ts.URL, owner.Address, removeOp)
+	code, _ = call(t, "DELETE", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, owner, tok))
+	assert.Equal(t, 200, code)
+	tok = token(t, ts.URL, owner.Address, downloadOp)
+	code, _ = call(t, "GET", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, owner, tok))
+	assert.Equal(t, 404, code)
+
+	// bad operations
+	code, _ = call(t, "POST", ts.URL+"/api/v1/auth",
+		[]byte(`{"user":"`+owner.Address+`","operation":{"name":"upload","hash":"zz"}}`), nil)
+	assert.Equal(t, 400, code)
+	code, _ = call(t, "POST", ts.URL+"/api/v1/auth",
+		[]byte(`{"user":"`+owner.Address+`","operation":{"name":"grant","id":"1"}}`), nil)
+	assert.Equal(t, 400, code)
+}
+
+// unread fails a test that reads it, to tell that a body was left alone.
+type unread struct{ t *testing.T }
+
+func (r unread) Read(p []byte) (int, error) {
+	r.t.Error("body read")
+	return 0, io.EOF
+}
+
+func TestServerLimits(t *testing.T) {
+	s, ts, done := newTestServer(t)
+	defer done()
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	assert.Equal(t, int64(DefaultMaxParcelSize), s.MaxParcelSize)
+
+	// no token, no reading the body
+	for _, path := range []string{"/api/v1/parcels", "/api/v1/manifests"} {
+		req := httptest.NewRequest("POST", path, unread{t})
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, 401, rec.Code)
+	}
+
+	s.MaxParcelSize = 16
+	data := bytes.Repeat([]byte("x"), 17)
+	body, _ := json.Marshal(uploadBody{
+		Owner: owner.Address,
+		Data:  hex.EncodeToString(bytes.Repeat(data, 4096)),
+	})
+	tok := token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+sha256Hex(data)+`"}`)
+	code, _ := call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 413, code)
+
+	hash := sha256Hex(data)
+	tok = token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+hash+`"}`)
+	code, _ = call(t, "POST", ts.URL+"/api/v1/chunks/"+hash, data, signed(t, owner, tok))
+	assert.Equal(t, 413, code)
+
+	// up to the limit goes through
+	data = data[:16]
+	body, _ = json.Marshal(uploadBody{
+		Owner: owner.Address,
+		Data:  hex.EncodeToString(data),
+	})
+	tok = token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+sha256Hex(data)+`"}`)
+	code, b := call(t, "POST", ts.URL+"/api/v1/parcels", body, signed(t, owner, tok))
+	assert.Equal(t, 200, code, string(b))
+}
+
+func TestServerTokenCap(t *testing.T) {
+	s, ts, done := newTestServer(t)
+	defer done()
+	s.Verifier.MaxPerClient = 1
+
+	op := `{"name":"download","id":"` + sha256Hex(nil) + `"}`
+	token(t, ts.URL, "AB01", op)
+	code, _ := call(t, "POST", ts.URL+"/api/v1/auth",
+		[]byte(`{"user":"AB01","operation":`+op+`}`), nil)
+	assert.Equal(t, 429, code)
+
+	// which does not lock out the user when asking from elsewhere
+	auth := func(remote string) int {
+		req := httptest.NewRequest("POST", "/api/v1/auth",
+			strings.NewReader(`{"user":"AB01","operation":`+op+`}`))
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, 200, auth("10.0.0.1:1234"))
+	assert.Equal(t, 429, auth("10.0.0.1:5678"))
+	assert.Equal(t, 200, auth("10.0.0.2:1234"))
+}
+
+func TestServerExpiry(t *testing.T) {
+	s, ts, done := newTestServer(t)
+	defer done()
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	s.Verifier.TTL = time.Millisecond
+
+	hash := sha256Hex([]byte("parcel data"))
+	tok := token(t, ts.URL, owner.Address, `{"name":"download","id":"`+hash+`"}`)
+	time.Sleep(10 * time.Millisecond)
+	code, b := call(t, "GET", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, owner, tok))
+	assert.Equal(t, 401, code)
+	assert.Contains(t, string(b), "Expired")
+}
+
+func TestServerChunks(t *testing.T) {
+	s, ts, done := newTestServer(t)
+	defer done()
+	owner, _ := keys.GenerateKey("owner", nil, false)
+
+	chunks := [][]byte{[]byte("first "), []byte("second")}
+	hashes := []string{sha256Hex(chunks[0]), sha256Hex(chunks[1])}
+	data := append(append([]byte{}, chunks[0]...), chunks[1]...)
+	hash := sha256Hex(data)
+
+	// a chunk that does not match its hash
+	tok := token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+hashes[0]+`"}`)
+	code, _ := call(t, "POST", ts.URL+"/api/v1/chunks/"+hashes[0], chunks[1], signed(t, owner, tok))
+	assert.Equal(t, 400, code)
+
+	for i, c := range chunks {
+		tok = token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+hashes[i]+`"}`)
+		code, b := call(t, "POST", ts.URL+"/api/v1/chunks/"+hashes[i], c, signed(t, owner, tok))
+		assert.Equal(t, 200, code, string(b))
+	}
+
+	finalize := func(m manifest) (int, []byte) {
+		body, _ := json.Marshal(m)
+		tok := token(t, ts.URL, owner.Address, `{"name":"upload","hash":"`+hash+`"}`)
+		return call(t, "POST", ts.URL+"/api/v1/manifests", body, signed(t, owner, tok))
+	}
+	m := manifest{
+		Owner:     owner.Address,
+		Metadata:  json.RawMessage(`{}`),
+		Hash:      hash,
+		Size:      int64(len(data)),
+		ChunkSize: int64(len(chunks[0])),
+	}
+
+	// more chunks than the size takes
+	m.Chunks = []string{hashes[0], hashes[1], hashes[1]}
+	code, _ = finalize(m)
+	assert.Equal(t, 400, code)
+	m.ChunkSize = 100
+	m.Chunks = hashes
+	code, _ = finalize(m)
+	assert.Equal(t, 400, code)
+	// chunks bigger than they should be
+	m.Size, m.ChunkSize = 2, 1
+	code, _ = finalize(m)
+	assert.Equal(t, 400, code)
+
+	m.Size, m.ChunkSize = int64(len(data)), int64(len(chunks[0]))
+	code, b := finalize(m)
+	assert.Equal(t, 200, code, string(b))
+	assert.Equal(t, `{"id":"`+hash+`"}`, string(b))
+
+	tok = token(t, ts.URL, owner.Address, `{"name":"download","id":"`+hash+`"}`)
+	code, b = call(t, "GET", ts.URL+"/api/v1/parcels/"+hash, nil, signed(t, owner, tok))
+	assert.Equal(t, 200, code)
+	assert.Equal(t, data, b)
+
+	// the chunks stay for other uploads sharing them
+	data = append(append([]byte{}, chunks[0]...), chunks[0]...)
+	hash = sha256Hex(data)
+	m.Hash, m.Chunks = hash, []string{hashes[0], hashes[0]}
+	code, b = finalize(m)
+	assert.Equal(t, 200, code, string(b))
+
+	// until collected
+	n, err := s.CollectChunks()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	s.ChunkTTL = -time.Second
+	n, err = s.CollectChunks()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	code, b = finalize(m)
+	assert.Equal(t, 400, code)
+	assert.Contains(t, string(b), "Missing chunk")
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Parcel is what the server keeps about a stored parcel besides its data.
+type Parcel struct {
+	ID       string          `json:"id"`
+	Owner    string          `json:"owner"`
+	Metadata json.RawMessage `json:"metadata"`
+	Hash     string          `json:"hash"`
+	Size     int64           `json:"size"`
+}
+
+var (
+	errNotFound  = errors.New("Not found")
+	errBadHash   = errors.New("Hash mismatch")
+	errBadDigest = errors.New("Not a sha256 hex digest")
+)
+
+// store keeps blobs on disk under the hex sha256 of their content, next to
+// the parcel records that point at them:
+//
+//	dir/blobs/<hash>       parcel data
+//	dir/chunks/<hash>      chunks of chunked uploads, until swept
+//	dir/parcels/<id>.json  parcel records
+//	dir/tmp/               files being written
+//
+// Files are written in tmp and renamed into place, so a crash never leaves
+// a blob that does not match its name.
+type store struct {
+	dir string
+	mtx sync.Mutex
+}
+
+func openStore(dir string) (*store, error) {
+	for _, sub := range []string{"blobs", "chunks", "parcels", "tmp"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &store{dir: dir}, nil
+}
+
+func validDigest(hash string) bool {
+	b, err := hex.DecodeString(hash)
+	return err == nil && len(b) == sha256.Size && hex.EncodeToString(b) == hash
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *store) path(kind, name string) string {
+	return filepath.Join(s.dir, kind, name)
+}
+
+// put writes r into kind/<hash>, failing if the content does not hash to
+// hash. It returns the number of bytes written.
+func (s *store) put(kind, hash string, r io.Reader) (int64, error) {
+	if !validDigest(hash) {
+		return 0, errBadDigest
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, "tmp"), kind+"-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return 0, errBadHash
+	}
+
+	return n, os.Rename(tmp.Name(), s.path(kind, hash))
+}
+
+func (s *store) open(kind, hash string) (*os.File, error) {
+	if !validDigest(hash) {
+		return nil, errNotFound
+	}
+	f, err := os.Open(s.path(kind, hash))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	return f, err
+}
+
+func (s *store) has(kind, hash string) bool {
+	if !validDigest(hash) {
+		return false
+	}
+	_, err := os.Stat(s.path(kind, hash))
+	return err == nil
+}
+
+// assemble concatenates chunks into a blob, which must hash to hash. No more
+// than size bytes and one are written, so that a blob too big fails the hash.
+func (s *store) assemble(hash string, chunks []string, size int64) (int64, error) {
+	files := make([]io.Reader, 0, len(chunks))
+	for _, c := range chunks {
+		f, err := s.open("chunks", c)
+		if err != nil {
+			return 0, errors.New("Missing chunk " + c)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	// the chunks are left for sweepChunks, as other uploads in flight may
+	// share them
+	return s.put("blobs", hash, io.LimitReader(io.MultiReader(files...), size+1))
+}
+
+// sweepChunks removes the chunks last uploaded before cutoff and returns how
+// many it removed.
+func (s *store) sweepChunks(cutoff time.Time) (int, error) {
+	dir := filepath.Join(s.dir, "chunks")
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, fi := range infos {
+		if fi.ModTime().Before(cutoff) && os.Remove(filepath.Join(dir, fi.Name())) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *store) getParcel(id string) (*Parcel, error) {
+	if !validDigest(id) {
+		return nil, errNotFound
+	}
+	b, err := ioutil.ReadFile(s.path("parcels", id+".json"))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Parcel
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// addParcel records p unless a parcel with the same ID is there already, in
+// which case that one is returned. Parcel IDs are content hashes, so the
+// same upload done twice makes one parcel.
+func (s *store) addParcel(p *Parcel) (*Parcel, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	old, err := s.getParcel(p.ID)
+	if err == nil {
+		return old, nil
+	}
+	if err != errNotFound {
+		return nil, err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, "tmp"), "parcel-")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	err = os.Rename(tmp.Name(), s.path("parcels", p.ID+".json"))
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *store) removeParcel(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	p, err := s.getParcel(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.path("parcels", id+".json"))
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.path("blobs", p.Hash))
+}
@@ -1,17 +1,35 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmclient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
 
+	"github.com/amolabs/amo-client-go/lib/envelope"
 	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
 )
 
 const (
@@ -19,6 +37,11 @@ const (
 	testBody  = "test parcel content"
 	testId    = "eeee"
 	testMeta  = `{"owner":"2f2f"}`
+	// a parcel the test storage does not have
+	testMissingId = "ffff"
+	// parcels the test storage is slow to answer for, or to send
+	testSlowId     = "dddd"
+	testSlowBodyId = "d0d0"
 )
 
 func testHandleAuth(w http.ResponseWriter, req *http.Request) {
@@ -67,12 +90,32 @@ func testHandleAuth(w http.ResponseWriter, req *http.Request) {
 	w.Write(rsp)
 }
 
+// last parcel received by testHandleUpload as a multipart stream
+var (
+	testUploaded []byte
+	// idempotency keys of the streamed uploads received, in order
+	testIdemKeys []string
+	// how many of the next streamed uploads to lose the response of
+	testUploadFailures int
+	// take the next removal but lose its response, then find the parcel gone
+	testRemoveLost bool
+	testRemoved    bool
+	// status to refuse the next removal with, doing nothing
+	testRemoveRefusal int
+	// idempotency keys of the removals received, in order
+	testRemoveKeys []string
+)
+
 func testHandleUpload(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		w.WriteHeader(405)
 		w.Write([]byte(`{"error":"Expected POST method"}`))
 		return
 	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		testHandleUploadStream(w, req)
+		return
+	}
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		w.WriteHeader(400)
@@ -92,6 +135,26 @@ func testHandleUpload(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte(`{"error":"malformed request body"}`))
 		return
 	}
+	data, err := hex.DecodeString(*uploadBody.Data)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"malformed data"}`))
+		return
+	}
+	testAcceptUpload(w, req, data)
+}
+
+// testAcceptUpload records an upload and answers it, or loses the response
+// as long as testUploadFailures says so.
+func testAcceptUpload(w http.ResponseWriter, req *http.Request, data []byte) {
+	testUploaded = data
+	testIdemKeys = append(testIdemKeys, req.Header.Get("Idempotency-Key"))
+	if testUploadFailures > 0 {
+		testUploadFailures--
+		w.WriteHeader(503)
+		w.Write([]byte(`{"error":"gateway lost the response"}`))
+		return
+	}
 
 	stoRes := struct {
 		Id string `json:"id"`
@@ -100,6 +163,130 @@ func testHandleUpload(w http.ResponseWriter, req *http.Request) {
 	w.Write(res)
 }
 
+func testHandleUploadStream(w http.ResponseWriter, req *http.Request) {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"malformed multipart body"}`))
+		return
+	}
+	fields := map[string]bool{}
+	var data bytes.Buffer
+	var hash string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"malformed multipart body"}`))
+			return
+		}
+		name := part.FormName()
+		fields[name] = true
+		if name == "data" {
+			h := sha256.New()
+			_, err = io.Copy(io.MultiWriter(&data, h), part)
+			if err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(`{"error":"broken data part"}`))
+				return
+			}
+			hash = hex.EncodeToString(h.Sum(nil))
+			if part.FileName() != hash {
+				w.WriteHeader(400)
+				w.Write([]byte(`{"error":"hash mismatch"}`))
+				return
+			}
+		}
+	}
+	if !fields["owner"] || !fields["metadata"] || !fields["data"] {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"malformed request body"}`))
+		return
+	}
+	testAcceptUpload(w, req, data.Bytes())
+}
+
+// chunks received by testHandleChunk, keyed by hash
+var (
+	testChunks     = map[string][]byte{}
+	testChunkPosts int
+	// when positive, testHandleChunk fails once this many chunks have been
+	// accepted, simulating a dropped backhaul link
+	testChunkLimit int
+)
+
+func testHandleChunk(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.WriteHeader(405)
+		w.Write([]byte(`{"error":"Expected POST method"}`))
+		return
+	}
+	if req.Header.Get("X-Auth-Token") != testToken {
+		w.WriteHeader(401)
+		w.Write([]byte(`{"error":"X-Auth-Token header missing"}`))
+		return
+	}
+	if testChunkLimit > 0 && testChunkPosts >= testChunkLimit {
+		w.WriteHeader(503)
+		w.Write([]byte(`{"error":"connection lost"}`))
+		return
+	}
+	hash := strings.TrimPrefix(req.URL.Path, "/api/v1/chunks/")
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"empty request body"}`))
+		return
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != hash {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"hash mismatch"}`))
+		return
+	}
+	testChunks[hash] = body
+	testChunkPosts++
+	w.Write([]byte(`{"hash":"` + hash + `"}`))
+}
+
+func testHandleManifest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.WriteHeader(405)
+		w.Write([]byte(`{"error":"Expected POST method"}`))
+		return
+	}
+	var manifest Manifest
+	err := json.NewDecoder(req.Body).Decode(&manifest)
+	if err != nil || len(manifest.Owner) == 0 || len(manifest.Chunks) == 0 {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"malformed request body"}`))
+		return
+	}
+	var data bytes.Buffer
+	for _, hash := range manifest.Chunks {
+		chunk, ok := testChunks[hash]
+		if !ok {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"Missing chunk ` + hash + `"}`))
+			return
+		}
+		data.Write(chunk)
+	}
+	sum := sha256.Sum256(data.Bytes())
+	if hex.EncodeToString(sum[:]) != manifest.Hash ||
+		int64(data.Len()) != manifest.Size {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"hash mismatch"}`))
+		return
+	}
+	testUploaded = data.Bytes()
+
+	w.Write([]byte(`{"id":"` + testId + `"}`))
+}
+
 func testHandleParcel(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" && req.Method != "DELETE" {
 		w.WriteHeader(405)
@@ -159,12 +346,77 @@ func testHandleParcel(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		switch {
+		case strings.HasSuffix(u.Path, "/"+testSlowId):
+			time.Sleep(300 * time.Millisecond)
+		case strings.HasSuffix(u.Path, "/"+testSlowBodyId):
+			w.WriteHeader(200)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(testBody))
+			return
+		}
+		if strings.HasSuffix(u.Path, "/"+testMissingId) {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":"parcel not found"}`))
+			return
+		}
+		if strings.HasSuffix(u.Path, "/"+testId) && testUploaded != nil {
+			w.Write(testUploaded)
+			return
+		}
 		w.Write([]byte(testBody))
 	} else if req.Method == "DELETE" {
+		// the signer may be a multisig of co-owners
+		pubKey, err := hex.DecodeString(req.Header.Get("X-Public-Key"))
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"malformed pubKey"}`))
+			return
+		}
+		sig, err := hex.DecodeString(req.Header.Get("X-Signature"))
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"malformed signature"}`))
+			return
+		}
+		if req.Header.Get("X-Auth-Token") != testToken ||
+			!keys.VerifyAccount(pubKey, []byte(testToken), sig) {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":"invalid signature"}`))
+			return
+		}
+		testRemoveKeys = append(testRemoveKeys, req.Header.Get("Idempotency-Key"))
+		if testRemoveRefusal > 0 {
+			w.WriteHeader(testRemoveRefusal)
+			w.Write([]byte(`{"error":"try again later"}`))
+			testRemoveRefusal = 0
+			return
+		}
+		if testRemoved || strings.HasSuffix(u.Path, "/"+testMissingId) {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":"parcel not found"}`))
+			return
+		}
+		if testRemoveLost {
+			testRemoved = true
+			w.WriteHeader(504)
+			w.Write([]byte(`{"error":"response lost"}`))
+		}
 	}
 }
 
+var setUpOnce sync.Once
+
+func signToken(key keys.KeyEntry, token []byte) ([]byte, error) {
+	return key.Sign(token)
+}
+
 func setUp() {
+	setUpOnce.Do(serve)
+}
+
+func serve() {
 	// serve test auth challenge
 	http.HandleFunc(
 		"/api/v1/auth",
@@ -175,13 +427,29 @@ func setUp() {
 		"/api/v1/parcels",
 		testHandleUpload,
 	)
+	// serve chunked upload
+	http.HandleFunc(
+		"/api/v1/chunks/",
+		testHandleChunk,
+	)
+	http.HandleFunc(
+		"/api/v1/manifests",
+		testHandleManifest,
+	)
 	// serve test parcel data
 	http.HandleFunc(
 		"/api/v1/parcels/",
 		testHandleParcel,
 	)
-	go http.ListenAndServe("localhost:12345", nil)
-	Endpoint = "http://localhost:12345"
+	// listen before returning so that tests do not race the server
+	l, err := net.Listen("tcp", "localhost:12345")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(l, nil)
+	DefaultClient.Endpoint = "http://localhost:12345"
+	DefaultClient.Retry.BaseDelay = time.Millisecond
+	DefaultClient.Retry.MaxDelay = 10 * time.Millisecond
 }
 
 func tearDown() {
@@ -204,14 +472,14 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `{"name":"download","id":"2f2f"}`, op)
 
-	authToken, err := requestToken("tester", `{ fjdska}`)
+	authToken, err := DefaultClient.requestToken(context.Background(), "download", "tester", `{ fjdska}`)
 	assert.Error(t, err)
 	assert.Nil(t, authToken)
 
 	key, err := keys.GenerateKey("tester", nil, false)
 	assert.NoError(t, err)
 
-	authToken, err = requestToken(key.Address, op)
+	authToken, err = DefaultClient.requestToken(context.Background(), "download", key.Address, op)
 	assert.NoError(t, err)
 	assert.NotNil(t, authToken)
 	assert.Equal(t, testToken, string(authToken))
@@ -220,15 +488,12 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, sig)
 
-	/* TODO
-	data, err := doDownload("ffff", authToken, key.PubKey, sig)
+	data, err := DefaultClient.doDownload(context.Background(), testMissingId, authToken, key.PubKey, sig)
 	assert.Error(t, err)
-	if err != nil {
-		fmt.Println(err)
-	}
-	*/
+	assert.True(t, IsNotFound(err))
+	assert.Nil(t, data)
 
-	data, err := doDownload("2f2f", authToken, key.PubKey, sig)
+	data, err = DefaultClient.doDownload(context.Background(), "2f2f", authToken, key.PubKey, sig)
 	assert.NoError(t, err)
 	if err != nil {
 		fmt.Println(err)
@@ -241,7 +506,7 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `{"name":"upload","hash":"ffff"}`, op)
 
-	authToken, err = requestToken(key.Address, op)
+	authToken, err = DefaultClient.requestToken(context.Background(), "upload", key.Address, op)
 	assert.NoError(t, err)
 	assert.NotNil(t, authToken)
 	assert.Equal(t, testToken, string(authToken))
@@ -250,7 +515,7 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, sig)
 
-	resJson, err := doUpload(key.Address, nil, authToken, key.PubKey, sig)
+	resJson, err := DefaultClient.doUpload(context.Background(), key.Address, nil, "", authToken, key.PubKey, sig)
 	assert.NoError(t, err)
 	if err != nil {
 		fmt.Println(err)
@@ -265,7 +530,7 @@ func TestAll(t *testing.T) {
 
 	// inspect
 	// XXX: inspect operation does not require auth
-	data, err = doInspect("1f1f")
+	data, err = DefaultClient.doInspect(context.Background(), "1f1f")
 	assert.NoError(t, err)
 	if err != nil {
 		fmt.Println(err)
@@ -279,7 +544,7 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `{"name":"remove","id":"3f3f"}`, op)
 
-	authToken, err = requestToken(key.Address, op)
+	authToken, err = DefaultClient.requestToken(context.Background(), "remove", key.Address, op)
 	assert.NoError(t, err)
 	assert.NotNil(t, authToken)
 	assert.Equal(t, testToken, string(authToken))
@@ -288,11 +553,522 @@ func TestAll(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, sig)
 
-	rsp, err := doRemove("2f2f", authToken, key.PubKey, sig)
+	rsp, err := DefaultClient.doRemove(context.Background(), "2f2f", "", authToken, key.PubKey, sig)
 	assert.NoError(t, err)
 	if err != nil {
 		fmt.Println(err)
 	}
 	assert.Empty(t, rsp)
 
-}
\ No newline at end of file
+}
+
+func TestStream(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	key, err := keys.GenerateKey("tester", nil, false)
+	assert.NoError(t, err)
+
+	// seekable source is hashed in place
+	parcel := bytes.Repeat([]byte("camera segment "), 1000)
+	resJson, err := UploadStream(context.Background(), bytes.NewReader(parcel), key)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+	assert.Equal(t, parcel, testUploaded)
+
+	// non-seekable source is spooled
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 1000; i++ {
+			pw.Write([]byte("camera segment "))
+		}
+		pw.Close()
+	}()
+	resJson, err = UploadStream(context.Background(), pr, key)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+	assert.Equal(t, parcel, testUploaded)
+
+	// JSON upload
+	_, err = Upload(context.Background(), []byte(testBody), key)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(testUploaded))
+
+	var buf bytes.Buffer
+	n, err := DownloadTo(context.Background(), "2f2f", &buf, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(testBody)), n)
+	assert.Equal(t, testBody, buf.String())
+
+	data, err := Download(context.Background(), "2f2f", key)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(data))
+	// token backed signer
+	dir, err := ioutil.TempDir("", "token")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	token, err := keys.OpenToken("file", dir)
+	assert.NoError(t, err)
+	assert.NoError(t, token.Login([]byte("1234")))
+	_, err = token.GenerateKeyPair("rsu")
+	assert.NoError(t, err)
+	signer, err := keys.NewTokenSigner(token, "rsu")
+	assert.NoError(t, err)
+	_, err = Upload(context.Background(), []byte(testBody), signer)
+	assert.NoError(t, err)
+	data, err = Download(context.Background(), "2f2f", signer)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(data))
+	_, err = Remove(context.Background(), "2f2f", signer)
+	assert.NoError(t, err)
+}
+
+func TestChunked(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	defer func(size int64) { ChunkSize = size }(ChunkSize)
+	ChunkSize = 1024
+	journal := filepath.Join(os.TempDir(), "test_upload_journal.json")
+	defer os.Remove(journal)
+	os.Remove(journal)
+
+	key, err := keys.GenerateKey("tester", nil, false)
+	assert.NoError(t, err)
+
+	// 10 full chunks and a short one
+	parcel := bytes.Repeat([]byte("0123456789abcdef"), 64*10+8)
+	for i := range parcel {
+		parcel[i] ^= byte(i / 1024)
+	}
+	testUploaded = nil
+	testChunkPosts = 0
+
+	// link drops after 4 chunks
+	testChunkLimit = 4
+	_, err = UploadChunked(context.Background(), bytes.NewReader(parcel), int64(len(parcel)), key, journal)
+	assert.Error(t, err)
+	assert.Nil(t, testUploaded)
+
+	b, err := ioutil.ReadFile(journal)
+	assert.NoError(t, err)
+	var j UploadJournal
+	assert.NoError(t, json.Unmarshal(b, &j))
+	assert.Equal(t, 11, len(j.Chunks))
+	assert.Equal(t, []bool{true, true, true, true, false, false, false, false, false, false, false}, j.Done)
+
+	// resume sends only what is left
+	testChunkLimit = 0
+	resJson, err := UploadChunked(context.Background(), bytes.NewReader(parcel), int64(len(parcel)), key, journal)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+	assert.Equal(t, 11, testChunkPosts)
+	assert.Equal(t, parcel, testUploaded)
+	_, err = os.Stat(journal)
+	assert.True(t, os.IsNotExist(err))
+
+	// a stale journal for other data is ignored
+	other := parcel[:3000]
+	testChunkLimit = 1
+	_, err = UploadChunked(context.Background(), bytes.NewReader(parcel), int64(len(parcel)), key, journal)
+	assert.Error(t, err)
+	testChunkLimit = 0
+	testChunkPosts = 0
+	_, err = UploadChunked(context.Background(), bytes.NewReader(other), int64(len(other)), key, journal)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, testChunkPosts)
+	assert.Equal(t, other, testUploaded)
+
+	// chunks journaled as done but lost on the server are sent again
+	testChunkLimit, testChunkPosts = 4, 0
+	_, err = UploadChunked(context.Background(), bytes.NewReader(parcel), int64(len(parcel)), key, journal)
+	assert.Error(t, err)
+	b, err = ioutil.ReadFile(journal)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &j))
+	delete(testChunks, j.Chunks[0])
+	delete(testChunks, j.Chunks[2])
+	testChunkLimit = 0
+	testChunkPosts = 0
+	testUploaded = nil
+	_, err = UploadChunked(context.Background(), bytes.NewReader(parcel), int64(len(parcel)), key, journal)
+	assert.NoError(t, err)
+	assert.Equal(t, 7+2, testChunkPosts)
+	assert.Equal(t, parcel, testUploaded)
+}
+
+func TestEncrypted(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	u1, err := keys.GenerateKey("u1", nil, false)
+	assert.NoError(t, err)
+	u2, err := keys.GenerateKey("u2", nil, false)
+	assert.NoError(t, err)
+
+	parcel := bytes.Repeat([]byte("encrypted file f1 "), 10000)
+	resJson, custody, err := UploadEncrypted(context.Background(), bytes.NewReader(parcel), u1)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+	assert.NotEqual(t, parcel, testUploaded)
+	assert.False(t, bytes.Contains(testUploaded, []byte("encrypted file f1")))
+
+	// owner reads back
+	var buf bytes.Buffer
+	err = DownloadDecrypted(context.Background(), testId, &buf, custody, *u1)
+	assert.NoError(t, err)
+	assert.Equal(t, parcel, buf.Bytes())
+
+	// u2 cannot use u1's custody
+	buf.Reset()
+	err = DownloadDecrypted(context.Background(), testId, &buf, custody, *u2)
+	assert.Error(t, err)
+
+	// u2 decrypts with key custody granted by u1
+	granted, err := envelope.Regrant(custody, u1, u2.PubKey)
+	assert.NoError(t, err)
+	buf.Reset()
+	err = DownloadDecrypted(context.Background(), testId, &buf, granted, *u2)
+	assert.NoError(t, err)
+	assert.Equal(t, parcel, buf.Bytes())
+}
+
+func TestMultisigRemove(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	city, _ := keys.GenerateKey("city", nil, false)
+	operator, _ := keys.GenerateKey("operator", nil, false)
+	outsider, _ := keys.GenerateKey("outsider", nil, false)
+	m, err := keys.NewMultisig(2, [][]byte{city.PubKey, operator.PubKey})
+	assert.NoError(t, err)
+
+	// one approval is not enough
+	auth, err := NewMultisigAuth(context.Background(), "remove", testId, m)
+	assert.NoError(t, err)
+	assert.NoError(t, auth.Approve(city))
+	assert.Error(t, auth.Approve(city))
+	assert.Error(t, auth.Approve(outsider))
+	assert.False(t, auth.Approved())
+	_, err = RemoveApproved(context.Background(), auth)
+	assert.Error(t, err)
+
+	// the operator approves on another box
+	b, err := json.Marshal(auth)
+	assert.NoError(t, err)
+	var received MultisigAuth
+	assert.NoError(t, json.Unmarshal(b, &received))
+	assert.NoError(t, received.Approve(operator))
+	assert.True(t, received.Approved())
+	_, err = RemoveApproved(context.Background(), &received)
+	assert.NoError(t, err)
+
+	// a partial signature over something else
+	p, _ := m.SignPartial(operator, []byte("another token"))
+	assert.Error(t, auth.Add(p))
+
+	// a forged combined signature
+	sig, _ := city.Sign([]byte(testToken))
+	_, err = DefaultClient.doRemove(context.Background(), testId, "", []byte(testToken), m.Encode(), sig)
+	assert.Error(t, err)
+
+	// both keys on one box
+	signer, err := keys.NewMultisigSigner(m, city, operator)
+	assert.NoError(t, err)
+	_, err = Remove(context.Background(), testId, signer)
+	assert.NoError(t, err)
+
+	auth, _ = NewMultisigAuth(context.Background(), "download", testId, m)
+	assert.NoError(t, auth.Approve(city))
+	assert.NoError(t, auth.Approve(operator))
+	_, err = RemoveApproved(context.Background(), auth)
+	assert.Error(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	c := NewClient(DefaultClient.Endpoint)
+	c.Retry.MaxAttempts = 1
+	key, _ := keys.GenerateKey("tester", nil, false)
+	sig, _ := key.Sign([]byte(testToken))
+
+	// not granted
+	_, err := c.doDownload(context.Background(), testId, []byte("stale"), key.PubKey, sig)
+	assert.True(t, IsUnauthorized(err))
+	assert.False(t, IsNotFound(err))
+	assert.False(t, IsUnavailable(err))
+	se, ok := err.(*StorageError)
+	assert.True(t, ok)
+	assert.Equal(t, "download", se.Op)
+	assert.Equal(t, 401, se.StatusCode)
+	assert.Equal(t, "X-Auth-Token header missing", se.Message)
+
+	_, err = c.doRemove(context.Background(), testId, "", []byte(testToken), key.PubKey, []byte("forged"))
+	assert.True(t, IsUnauthorized(err))
+	assert.Equal(t, "remove", err.(*StorageError).Op)
+
+	_, err = c.doDownload(context.Background(), testMissingId, []byte(testToken), key.PubKey, sig)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "parcel not found", err.(*StorageError).Message)
+
+	// a body that is not JSON is kept whole
+	c.Endpoint += "/nowhere"
+	_, err = c.doInspect(context.Background(), testId)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "inspect", err.(*StorageError).Op)
+	assert.Equal(t, "404 page not found", err.(*StorageError).Message)
+	// and so is a refused token
+	_, err = c.Download(context.Background(), testId, key)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "download", err.(*StorageError).Op)
+	c.Endpoint = DefaultClient.Endpoint
+
+	testChunkLimit, testChunkPosts = 1, 1
+	_, err = c.doUploadChunk(context.Background(), hexSum(sha256.New()), bytes.NewReader(nil), []byte(testToken), key.PubKey, sig)
+	testChunkLimit, testChunkPosts = 0, 0
+	assert.True(t, IsUnavailable(err))
+	assert.Equal(t, "upload", err.(*StorageError).Op)
+
+	// server down
+	c.Endpoint = "http://localhost:1"
+	_, err = c.Inspect(context.Background(), testId)
+	assert.Error(t, err)
+	assert.True(t, IsUnavailable(err))
+	assert.False(t, IsUnauthorized(err))
+	assert.False(t, IsNotFound(err))
+}
+
+func TestRetry(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	c := NewClient(DefaultClient.Endpoint)
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+	key, _ := keys.GenerateKey("tester", nil, false)
+	parcel := bytes.Repeat([]byte("camera segment "), 100)
+
+	// two lost responses, then through, all as the same upload
+	testIdemKeys = nil
+	testUploadFailures = 2
+	resJson, err := c.Upload(context.Background(), parcel, key)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+	assert.Equal(t, parcel, testUploaded)
+	assert.Equal(t, 3, len(testIdemKeys))
+	assert.NotEmpty(t, testIdemKeys[0])
+	assert.Equal(t, testIdemKeys[0], testIdemKeys[1])
+	assert.Equal(t, testIdemKeys[0], testIdemKeys[2])
+
+	// a non-seekable source is rewound from its spool
+	testUploadFailures = 1
+	_, err = c.UploadStream(context.Background(), io.MultiReader(bytes.NewReader(parcel)), key)
+	assert.NoError(t, err)
+	assert.Equal(t, parcel, testUploaded)
+	assert.Equal(t, 5, len(testIdemKeys))
+	assert.NotEqual(t, testIdemKeys[0], testIdemKeys[3])
+
+	// out of attempts
+	testUploadFailures = 5
+	_, err = c.Upload(context.Background(), parcel, key)
+	assert.True(t, IsUnavailable(err))
+	assert.Equal(t, 8, len(testIdemKeys))
+	testUploadFailures = 0
+
+	// refusals are not retried
+	c.Endpoint += "/nowhere"
+	_, err = c.Remove(context.Background(), testId, key)
+	assert.True(t, IsNotFound(err))
+	c.Endpoint = DefaultClient.Endpoint
+
+	// a removal that went through with its response lost
+	testRemoveKeys = nil
+	testRemoveLost = true
+	_, err = c.Remove(context.Background(), testId, key)
+	testRemoveLost, testRemoved = false, false
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(testRemoveKeys))
+	assert.NotEmpty(t, testRemoveKeys[0])
+	assert.Equal(t, testRemoveKeys[0], testRemoveKeys[1])
+
+	// but a parcel that was never there is not found, even on a retry
+	testRemoveRefusal = 503
+	_, err = c.Remove(context.Background(), testMissingId, key)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, 4, len(testRemoveKeys))
+
+	// nor is a malformed endpoint
+	c.Endpoint = "ftp://localhost:12345"
+	_, err = c.Inspect(context.Background(), testId)
+	assert.Error(t, err)
+	assert.False(t, IsUnavailable(err))
+	c.Endpoint = DefaultClient.Endpoint
+
+	// the caller gives up while waiting for the next attempt
+	c.Retry.BaseDelay, c.Retry.MaxDelay = time.Minute, time.Minute
+	testUploadFailures = 5
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = c.Upload(ctx, parcel, key)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 9, len(testIdemKeys))
+	testUploadFailures = 0
+
+	// the timeout bounds getting the response but not streaming it
+	c.Timeout = 50 * time.Millisecond
+	c.Retry.MaxAttempts = 1
+	_, err = c.Download(context.Background(), testSlowId, key)
+	assert.True(t, IsUnavailable(err))
+	data, err := c.Download(context.Background(), testSlowBodyId, key)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(data))
+	// nor sending the request
+	chunk := []byte("slowly sent chunk")
+	sum := sha256.Sum256(chunk)
+	sig, _ := key.Sign([]byte(testToken))
+	_, err = c.doUploadChunk(context.Background(), hex.EncodeToString(sum[:]),
+		&slowReader{chunk, 10 * time.Millisecond}, []byte(testToken), key.PubKey, sig)
+	assert.NoError(t, err)
+
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n := 1; n < 10; n++ {
+		d := p.delay(n)
+		max := p.BaseDelay << uint(n-1)
+		if max > p.MaxDelay {
+			max = p.MaxDelay
+		}
+		assert.True(t, max/2 <= d && d <= max, n)
+	}
+}
+
+// slowReader hands out its data a byte at a time, pausing before each.
+type slowReader struct {
+	data  []byte
+	pause time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.pause)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+// testChain answers storage queries from storage records keyed by ID.
+type testChain struct {
+	mtx      sync.Mutex
+	storages map[string]string
+}
+
+func (c *testChain) set(id, record string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.storages[id] = record
+}
+
+func (c *testChain) Status(ctx context.Context) (*ctypes.ResultStatus, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *testChain) ABCIQueryWithOptions(ctx context.Context, path string, data tmbytes.HexBytes,
+	opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if path != "/Storage" {
+		return nil, errors.New("unexpected query " + path)
+	}
+	var value []byte
+	if record, ok := c.storages[string(data)]; ok {
+		value = []byte(record)
+	}
+	return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Value: value}}, nil
+}
+
+func (c *testChain) Commit(ctx context.Context, height *int64) (*ctypes.ResultCommit, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *testChain) BroadcastTxCommit(ctx context.Context, tx tmtypes.Tx) (*ctypes.ResultBroadcastTxCommit, error) {
+	return nil, errors.New("not implemented")
+}
+
+func testStorage(url string, regFee, hostFee int, active bool) string {
+	return fmt.Sprintf(`{"owner":"2F2F","url":"%s","registration_fee":"%d","hosting_fee":"%d","active":%t}`,
+		url, regFee, hostFee, active)
+}
+
+func TestRegistry(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	chain := &testChain{storages: map[string]string{
+		"1": testStorage("http://localhost:1", 10, 5, true),
+		"2": testStorage(DefaultClient.Endpoint+"/", 3, 3, true),
+		"3": testStorage("http://localhost:3", 0, 0, false),
+		"5": testStorage("", 0, 0, true),
+	}}
+	rpc.SetTransport(chain)
+	defer rpc.SetTransport(nil)
+	ctx := context.Background()
+
+	template := NewClient("")
+	template.Timeout = 5 * time.Second
+	r := NewRegistry(template)
+	c, err := r.Client(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultClient.Endpoint, c.Endpoint)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Empty(t, template.Endpoint)
+	again, _ := r.Client(ctx, "2")
+	assert.True(t, c == again)
+
+	_, err = r.Client(ctx, "3")
+	assert.Equal(t, ErrInactive, err)
+	_, err = r.Client(ctx, "4")
+	assert.Error(t, err)
+	_, err = r.Client(ctx, "5")
+	assert.Error(t, err)
+	_, err = r.Client(ctx, "storage")
+	assert.Error(t, err)
+
+	// several storages at once
+	c1, err := r.Client(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:1", c1.Endpoint)
+	assert.Equal(t, DefaultClient.Endpoint, c.Endpoint)
+
+	id, c, err := r.Cheapest(ctx, "1", "2", "3", "4", "5")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", id)
+	key, _ := keys.GenerateKey("tester", nil, false)
+	resJson, err := c.Upload(context.Background(), []byte(testBody), key)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"`+testId+`"}`, string(resJson))
+
+	// the chain deactivates it
+	chain.set("2", testStorage(DefaultClient.Endpoint, 3, 3, false))
+	id, _, err = r.Cheapest(ctx, "1", "2", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+	_, err = r.Client(ctx, "2")
+	assert.Equal(t, ErrInactive, err)
+
+	// and back, at a new address, with fees that tie
+	chain.set("2", testStorage("http://localhost:2", 5, 10, true))
+	id, c, err = r.Cheapest(ctx, "1", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+	id, c, err = r.Cheapest(ctx, "2", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", id)
+	assert.Equal(t, "http://localhost:2", c.Endpoint)
+
+	_, _, err = r.Cheapest(ctx, "3", "4")
+	assert.Error(t, err)
+	_, _, err = r.Cheapest(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/amolabs/amo-client-go/lib/envelope"
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+type UploadBody struct {
+	Owner    string          `json:"owner"`
+	Metadata json.RawMessage `json:"metadata"`
+	Data     string          `json:"data"`
+}
+
+// TODO: derive owner from pubKey
+func (c *Client) doUpload(ctx context.Context, owner string, data []byte, idemKey string, token, pubKey, sig []byte) ([]byte, error) {
+	uploadBody := UploadBody{
+		Owner:    owner,
+		Metadata: []byte(`{"owner":"` + owner + `"}`),
+		Data:     hex.EncodeToString(data),
+	}
+	reqJson, err := json.Marshal(uploadBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.Endpoint+"/api/v1/parcels",
+		bytes.NewBuffer(reqJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+	if len(idemKey) > 0 {
+		req.Header.Add("Idempotency-Key", idemKey)
+	}
+
+	ret, err := c.doOp("upload", req)
+	return ret, err
+}
+
+// doUploadStream sends the parcel as a multipart/form-data body with the raw
+// parcel bytes in the "data" part. The body is produced through a pipe, so
+// the request goes out with chunked transfer encoding and nothing but the
+// copy buffer is held in memory. The data is hashed again on the way out and
+// the upload is aborted if it does not match the hash the token was issued
+// for. The idempotency key, if any, is the same for every attempt.
+func (c *Client) doUploadStream(ctx context.Context, owner string, data io.Reader, hash, idemKey string, token, pubKey, sig []byte) ([]byte, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(writeUploadForm(mw, owner, data, hash))
+		close(done)
+	}()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.Endpoint+"/api/v1/parcels",
+		pr,
+	)
+	if err != nil {
+		pr.Close()
+		<-done
+		return nil, err
+	}
+	req.Header.Add("Content-Type", mw.FormDataContentType())
+	req.Header.Add("X-Auth-Token", string(token))
+	req.Header.Add("X-Public-Key", hex.EncodeToString(pubKey))
+	req.Header.Add("X-Signature", hex.EncodeToString(sig))
+	if len(idemKey) > 0 {
+		req.Header.Add("Idempotency-Key", idemKey)
+	}
+
+	ret, err := c.doOp("upload", req)
+	// unblock the writer goroutine if the request failed half way, and let
+	// it be done with data before another attempt rewinds it
+	pr.Close()
+	<-done
+	return ret, err
+}
+
+func writeUploadForm(mw *multipart.Writer, owner string, data io.Reader, hash string) error {
+	err := mw.WriteField("owner", owner)
+	if err != nil {
+		return err
+	}
+	err = mw.WriteField("metadata", `{"owner":"`+owner+`"}`)
+	if err != nil {
+		return err
+	}
+	part, err := mw.CreateFormFile("data", hash)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(part, io.TeeReader(data, h))
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return errors.New("Parcel data changed during upload")
+	}
+
+	return mw.Close()
+}
+
+// hashParcel returns the hex-encoded sha256 of the parcel and a reader
+// positioned at the start of the parcel, which can be sought back there for
+// another attempt. A seekable source is hashed in place and rewound.
+// Anything else is spooled to a temporary file while hashing, since the hash
+// must be known before the auth token can be requested. The returned cleanup
+// func must be called once the reader is no longer needed.
+func hashParcel(r io.Reader) (string, io.ReadSeeker, func(), error) {
+	h := sha256.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		_, err = io.Copy(h, rs)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		_, err = rs.Seek(start, io.SeekStart)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return hexSum(h), rs, func() {}, nil
+	}
+
+	f, err := ioutil.TempFile("", "parcel-")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	_, err = io.Copy(f, io.TeeReader(r, h))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, nil, err
+	}
+
+	return hexSum(h), f, cleanup, nil
+}
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// UploadStream uploads a parcel read from r without buffering it in memory.
+func (c *Client) UploadStream(ctx context.Context, r io.Reader, signer keys.Signer) ([]byte, error) {
+	hash, data, cleanup, err := hashParcel(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	start, err := data.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	idemKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []byte
+	err = c.retry(ctx, func() error {
+		_, err := data.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		authToken, sig, err := c.authorize(ctx, "upload", hash, signer)
+		if err != nil {
+			return err
+		}
+		ret, err = c.doUploadStream(ctx, signer.GetAddress(), data, hash, idemKey, authToken, signer.PublicKey(), sig)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func UploadStream(ctx context.Context, r io.Reader, signer keys.Signer) ([]byte, error) {
+	return DefaultClient.UploadStream(ctx, r, signer)
+}
+
+// Upload sends the parcel hex encoded in a JSON body, which every storage
+// takes. UploadStream sends it as a multipart stream instead, which is better
+// for big parcels but needs a storage that takes multipart uploads.
+func (c *Client) Upload(ctx context.Context, data []byte, signer keys.Signer) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	idemKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []byte
+	err = c.retry(ctx, func() error {
+		authToken, sig, err := c.authorize(ctx, "upload", hash, signer)
+		if err != nil {
+			return err
+		}
+		ret, err = c.doUpload(ctx, signer.GetAddress(), data, idemKey, authToken, signer.PublicKey(), sig)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func Upload(ctx context.Context, data []byte, signer keys.Signer) ([]byte, error) {
+	return DefaultClient.Upload(ctx, data, signer)
+}
+
+// UploadEncrypted encrypts the parcel under a fresh data key on its way to the
+// storage and returns the upload response together with the custody of the
+// data key for the uploader. The plain data never leaves the box. Opening the
+// custody needs the private key itself, so signers that keep it sealed in
+// hardware cannot read their own uploads back with DownloadDecrypted.
+func (c *Client) UploadEncrypted(ctx context.Context, r io.Reader, signer keys.Signer) ([]byte, []byte, error) {
+	dataKey, err := envelope.NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	custody, err := envelope.Custody(dataKey, signer.PublicKey())
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := envelope.NewEncryptingReader(r, dataKey)
+	defer enc.Close()
+
+	ret, err := c.UploadStream(ctx, enc, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ret, custody, nil
+}
+
+func UploadEncrypted(ctx context.Context, r io.Reader, signer keys.Signer) ([]byte, []byte, error) {
+	return DefaultClient.UploadEncrypted(ctx, r, signer)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+var (
+	ErrUnknownToken = errors.New("Unknown or used token")
+	ErrExpiredToken = errors.New("Expired token")
+	ErrKeyMismatch  = errors.New("Public key is not the token user's")
+	ErrBadSignature = errors.New("Invalid signature")
+	// returned by Issue when too many tokens are waiting to be used
+	ErrTooManyTokens = errors.New("Too many outstanding tokens")
+)
+
+// Challenge is an auth token handed out to one user for one operation.
+type Challenge struct {
+	User      string
+	Operation string
+	Expires   time.Time
+}
+
+// Default caps on the tokens a Verifier keeps waiting to be used
+const (
+	DefaultMaxTokensPerClient = 16
+	DefaultMaxTokens          = 1 << 16
+)
+
+// Verifier is the storage side of the token challenge: it issues the tokens
+// requested at /api/v1/auth and checks the tokens that come back signed in
+// the X-Auth-Token, X-Public-Key and X-Signature headers.
+type Verifier struct {
+	// TTL is how long a token may wait to be used.
+	TTL time.Duration
+	// MaxPerClient and MaxTokens cap the tokens waiting to be used, for one
+	// client and in all, so that unused tokens cannot pile up; zero means no
+	// cap. The cap is not per user, as anyone may ask for tokens in any
+	// user's name.
+	MaxPerClient int
+	MaxTokens    int
+
+	mtx    sync.Mutex
+	issued map[string]*list.Element
+	// oldest first, so that the expired ones are at the front
+	order     *list.List
+	perClient map[string]int
+}
+
+type issuedToken struct {
+	token  string
+	client string
+	Challenge
+}
+
+func NewVerifier(ttl time.Duration) *Verifier {
+	return &Verifier{
+		TTL:          ttl,
+		MaxPerClient: DefaultMaxTokensPerClient,
+		MaxTokens:    DefaultMaxTokens,
+		issued:       map[string]*list.Element{},
+		order:        list.New(),
+		perClient:    map[string]int{},
+	}
+}
+
+// Issue returns a fresh token for user to sign for operation, which the
+// verifier keeps as given for the caller to compare. client identifies the
+// caller by something it cannot choose, such as its IP address, for
+// MaxPerClient.
+func (v *Verifier) Issue(client, user, operation string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	now := time.Now()
+	v.sweep(now)
+	if v.MaxTokens > 0 && len(v.issued) >= v.MaxTokens {
+		return "", ErrTooManyTokens
+	}
+	if v.MaxPerClient > 0 && v.perClient[client] >= v.MaxPerClient {
+		return "", ErrTooManyTokens
+	}
+	v.issued[token] = v.order.PushBack(&issuedToken{
+		token:  token,
+		client: client,
+		Challenge: Challenge{
+			User:      user,
+			Operation: operation,
+			Expires:   now.Add(v.TTL),
+		},
+	})
+	v.perClient[client]++
+
+	return token, nil
+}
+
+// sweep drops the tokens expired by now. Tokens are issued in order of
+// expiry unless TTL is changed on the way, which only keeps some a little
+// longer.
+func (v *Verifier) sweep(now time.Time) {
+	for e := v.order.Front(); e != nil; e = v.order.Front() {
+		if !now.After(e.Value.(*issuedToken).Expires) {
+			return
+		}
+		v.remove(e)
+	}
+}
+
+func (v *Verifier) remove(e *list.Element) {
+	it := v.order.Remove(e).(*issuedToken)
+	delete(v.issued, it.token)
+	v.perClient[it.client]--
+	if v.perClient[it.client] <= 0 {
+		delete(v.perClient, it.client)
+	}
+}
+
+// accountAddress derives the address of a public key as the key store does
+// for its own keys, that is from the uncompressed form. Multisig accounts
+// are addressed by their encoding.
+func accountAddress(pubKey []byte) (string, error) {
+	if keys.IsMultisig(pubKey) {
+		return keys.DeriveAddress(pubKey), nil
+	}
+	b, err := keys.DecompressPubKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return keys.DeriveAddress(b), nil
+}
+
+// Verify takes back a token, checking that it was signed by the key of the
+// user it was issued to, and returns what it was issued for. A token is good
+// for one try, whether the signature checks out or not.
+func (v *Verifier) Verify(token string, pubKey, sig []byte) (*Challenge, error) {
+	v.mtx.Lock()
+	e, ok := v.issued[token]
+	var c Challenge
+	if ok {
+		c = e.Value.(*issuedToken).Challenge
+		v.remove(e)
+	}
+	v.mtx.Unlock()
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+	if time.Now().After(c.Expires) {
+		return nil, ErrExpiredToken
+	}
+	addr, err := accountAddress(pubKey)
+	if err != nil || addr != c.User {
+		return nil, ErrKeyMismatch
+	}
+	if !keys.VerifyAccount(pubKey, []byte(token), sig) {
+		return nil, ErrBadSignature
+	}
+
+	return &c, nil
+}
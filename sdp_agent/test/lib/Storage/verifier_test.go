@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+const testClient = "10.0.0.1"
+
+func TestVerifier(t *testing.T) {
+	v := NewVerifier(time.Minute)
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	other, _ := keys.GenerateKey("other", nil, false)
+	op := `{"name":"download","id":"2f2f"}`
+
+	token, err := v.Issue(testClient, owner.Address, op)
+	assert.NoError(t, err)
+	sig, err := owner.Sign([]byte(token))
+	assert.NoError(t, err)
+	c, err := v.Verify(token, owner.PubKey, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, owner.Address, c.User)
+	assert.Equal(t, op, c.Operation)
+
+	// replay
+	_, err = v.Verify(token, owner.PubKey, sig)
+	assert.Equal(t, ErrUnknownToken, err)
+
+	// signed with another key
+	token, _ = v.Issue(testClient, owner.Address, op)
+	sig, _ = other.Sign([]byte(token))
+	_, err = v.Verify(token, other.PubKey, sig)
+	assert.Equal(t, ErrKeyMismatch, err)
+	// the failed try used the token up
+	sig, _ = owner.Sign([]byte(token))
+	_, err = v.Verify(token, owner.PubKey, sig)
+	assert.Equal(t, ErrUnknownToken, err)
+
+	// the user's key over another's signature
+	token, _ = v.Issue(testClient, owner.Address, op)
+	sig, _ = other.Sign([]byte(token))
+	_, err = v.Verify(token, owner.PubKey, sig)
+	assert.Equal(t, ErrBadSignature, err)
+
+	// a signature over another token
+	token, _ = v.Issue(testClient, owner.Address, op)
+	token2, _ := v.Issue(testClient, owner.Address, op)
+	sig, _ = owner.Sign([]byte(token2))
+	_, err = v.Verify(token, owner.PubKey, sig)
+	assert.Equal(t, ErrBadSignature, err)
+
+	// a malformed key
+	token, _ = v.Issue(testClient, owner.Address, op)
+	sig, _ = owner.Sign([]byte(token))
+	_, err = v.Verify(token, owner.PubKey[:40], sig)
+	assert.Equal(t, ErrKeyMismatch, err)
+
+	// the compressed key is the same account
+	token, _ = v.Issue(testClient, owner.Address, op)
+	sig, _ = owner.Sign([]byte(token))
+	compressed, err := keys.CompressPubKey(owner.PubKey)
+	assert.NoError(t, err)
+	_, err = v.Verify(token, compressed, sig)
+	assert.NoError(t, err)
+
+	// never issued
+	_, err = v.Verify("deadbeef", owner.PubKey, sig)
+	assert.Equal(t, ErrUnknownToken, err)
+}
+
+func TestVerifierExpiry(t *testing.T) {
+	v := NewVerifier(time.Millisecond)
+	owner, _ := keys.GenerateKey("owner", nil, false)
+	op := `{"name":"remove","id":"2f2f"}`
+
+	token, _ := v.Issue(testClient, owner.Address, op)
+	sig, _ := owner.Sign([]byte(token))
+	time.Sleep(10 * time.Millisecond)
+	_, err := v.Verify(token, owner.PubKey, sig)
+	assert.Equal(t, ErrExpiredToken, err)
+
+	// issuing sweeps out the expired tokens
+	v.Issue(testClient, owner.Address, op)
+	time.Sleep(10 * time.Millisecond)
+	v.Issue(testClient, owner.Address, op)
+	assert.Len(t, v.issued, 1)
+	assert.Equal(t, 1, v.order.Len())
+	assert.Equal(t, 1, v.perClient[testClient])
+}
+
+func TestVerifierCaps(t *testing.T) {
+	v := NewVerifier(time.Minute)
+	v.MaxPerClient, v.MaxTokens = 2, 3
+	op := `{"name":"download","id":"2f2f"}`
+
+	token, err := v.Issue("10.0.0.1", "A", op)
+	assert.NoError(t, err)
+	_, err = v.Issue("10.0.0.1", "A", op)
+	assert.NoError(t, err)
+	_, err = v.Issue("10.0.0.1", "B", op)
+	assert.Equal(t, ErrTooManyTokens, err)
+
+	// one client cannot use up the tokens of a user for another
+	_, err = v.Issue("10.0.0.2", "A", op)
+	assert.NoError(t, err)
+
+	// a used token makes room for another
+	v.Verify(token, nil, nil)
+	_, err = v.Issue("10.0.0.1", "A", op)
+	assert.NoError(t, err)
+
+	_, err = v.Issue("10.0.0.3", "C", op)
+	assert.Equal(t, ErrTooManyTokens, err)
+
+	// and so do expired ones
+	v = NewVerifier(-time.Second)
+	v.MaxPerClient = 1
+	for i := 0; i < 3; i++ {
+		_, err = v.Issue("10.0.0.1", "A", op)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, v.issued, 1)
+}
+
+func TestVerifierMultisig(t *testing.T) {
+	v := NewVerifier(time.Minute)
+	city, _ := keys.GenerateKey("city", nil, false)
+	operator, _ := keys.GenerateKey("operator", nil, false)
+	m, err := keys.NewMultisig(2, [][]byte{city.PubKey, operator.PubKey})
+	assert.NoError(t, err)
+	signer, err := keys.NewMultisigSigner(m, city, operator)
+	assert.NoError(t, err)
+	op := `{"name":"remove","id":"2f2f"}`
+
+	token, _ := v.Issue(testClient, m.Address(), op)
+	sig, err := signer.Sign([]byte(token))
+	assert.NoError(t, err)
+	_, err = v.Verify(token, m.Encode(), sig)
+	assert.NoError(t, err)
+
+	// a member cannot speak for the multisig
+	token, _ = v.Issue(testClient, m.Address(), op)
+	sig, _ = city.Sign([]byte(token))
+	_, err = v.Verify(token, city.PubKey, sig)
+	assert.Equal(t, ErrKeyMismatch, err)
+}
@@ -0,0 +1,179 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// A certificate is bound to an account by a URI SAN of the form
+// amo:<ADDRESS>, and by its public key hashing to that same address. The
+// SAN lets TLS peers such as the SDP gateway read the address without
+// knowing how addresses are derived; the key check keeps a careless or
+// compromised CA from binding an address to someone else's key.
+const uriScheme = "amo"
+
+func AddressURI(address string) *url.URL {
+	return &url.URL{Scheme: uriScheme, Opaque: strings.ToUpper(address)}
+}
+
+// CreateCSR returns a PEM encoded certificate signing request for the key,
+// carrying its address. The key must be decrypted first.
+func CreateCSR(key *keys.KeyEntry, commonName string) ([]byte, error) {
+	privKey, err := key.ToECDSA()
+	if err != nil {
+		return nil, err
+	}
+	if len(commonName) == 0 {
+		commonName = key.Address
+	}
+	template := &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: commonName},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		URIs:               []*url.URL{AddressURI(key.Address)},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+func decodePEM(b []byte, blockType string) ([]byte, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != blockType {
+		return nil, errors.New("No " + blockType + " PEM block found")
+	}
+	return block.Bytes, nil
+}
+
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	der, err := decodePEM(csrPEM, "CERTIFICATE REQUEST")
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	return csr, nil
+}
+
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	der, err := decodePEM(certPEM, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// addressOf returns the address named in the URIs and checks that the
+// public key belongs to it.
+func addressOf(uris []*url.URL, pub crypto.PublicKey) (string, error) {
+	var address string
+	for _, u := range uris {
+		if u.Scheme != uriScheme {
+			continue
+		}
+		if len(address) > 0 {
+			return "", errors.New("More than one address in certificate")
+		}
+		address = u.Opaque
+	}
+	if len(address) == 0 {
+		return "", errors.New("No address in certificate")
+	}
+
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("Not an EC public key")
+	}
+	raw, err := keys.FromECDSAPubKey(ecPub)
+	if err != nil {
+		return "", err
+	}
+	if keys.DeriveAddress(raw) != address {
+		return "", errors.New("Public key does not match address " + address)
+	}
+
+	return address, nil
+}
+
+// Issue signs a certificate for the CSR with the CA, after checking that the
+// key in the CSR belongs to the address it claims. The certificate is good
+// for TLS client authentication.
+func Issue(csrPEM []byte, caCert *x509.Certificate, caKey crypto.Signer, validFor time.Duration) ([]byte, error) {
+	csr, err := ParseCSR(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	address, err := addressOf(csr.URIs, csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      csr.Subject,
+		URIs:         []*url.URL{AddressURI(address)},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// AddressOf returns the address a certificate is bound to.
+func AddressOf(cert *x509.Certificate) (string, error) {
+	return addressOf(cert.URIs, cert.PublicKey)
+}
+
+// VerifyAddress checks that the certificate chains up to one of roots, is
+// valid for client authentication and belongs to address. A nil roots skips
+// the chain check, for callers that already did it, e.g. in a TLS handshake.
+func VerifyAddress(cert *x509.Certificate, roots *x509.CertPool, address string) error {
+	if roots != nil {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	got, err := AddressOf(cert)
+	if err != nil {
+		return err
+	}
+	if got != strings.ToUpper(address) {
+		return errors.New("Certificate belongs to " + got + ", not " + address)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func testCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, *x509.CertPool) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sdp test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	return caCert, caKey, roots
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	caCert, caKey, roots := testCA(t)
+	key, err := keys.GenerateKey("rsu", nil, false)
+	assert.NoError(t, err)
+
+	csrPEM, err := CreateCSR(key, "")
+	assert.NoError(t, err)
+	csr, err := ParseCSR(csrPEM)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Address, csr.Subject.CommonName)
+
+	certPEM, err := Issue(csrPEM, caCert, caKey, time.Hour)
+	assert.NoError(t, err)
+	cert, err := ParseCertificate(certPEM)
+	assert.NoError(t, err)
+
+	address, err := AddressOf(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Address, address)
+	assert.NoError(t, VerifyAddress(cert, roots, key.Address))
+	assert.NoError(t, VerifyAddress(cert, nil, key.Address))
+
+	other, err := keys.GenerateKey("other", nil, false)
+	assert.NoError(t, err)
+	assert.Error(t, VerifyAddress(cert, roots, other.Address))
+
+	// untrusted CA
+	_, _, otherRoots := testCA(t)
+	assert.Error(t, VerifyAddress(cert, otherRoots, key.Address))
+
+	enc, err := keys.GenerateKey("rsu", []byte("pass"), true)
+	assert.NoError(t, err)
+	_, err = CreateCSR(enc, "")
+	assert.Error(t, err)
+}
+
+func TestAddressMismatch(t *testing.T) {
+	caCert, caKey, roots := testCA(t)
+	key, err := keys.GenerateKey("rsu", nil, false)
+	assert.NoError(t, err)
+	victim, err := keys.GenerateKey("victim", nil, false)
+	assert.NoError(t, err)
+
+	// CSR claiming someone else's address is refused
+	privKey, err := key.ToECDSA()
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "rsu"},
+		URIs:    []*url.URL{AddressURI(victim.Address)},
+	}, privKey)
+	assert.NoError(t, err)
+	forged := pemEncode("CERTIFICATE REQUEST", der)
+	_, err = Issue(forged, caCert, caKey, time.Hour)
+	assert.Error(t, err)
+
+	// and so is such a certificate from a careless CA
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{AddressURI(victim.Address)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &privKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	assert.Error(t, VerifyAddress(cert, roots, victim.Address))
+	assert.Error(t, VerifyAddress(cert, roots, key.Address))
+}
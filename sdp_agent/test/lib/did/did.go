@@ -0,0 +1,310 @@
+package did
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+// DID is a decentralized identifier, possibly with the path, query and
+// fragment of a DID URL, as in did:amo:1234ABCD/path?query#key-1.
+type DID struct {
+	Method   string
+	ID       string
+	Path     string
+	Query    string
+	Fragment string
+}
+
+func isMethodChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9'
+}
+
+func isIDChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '.' || c == '-' || c == '_'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// validID checks the method specific ID against the DID Core ABNF: idchars
+// and percent escapes in colon separated segments, the last one not empty.
+func validID(id string) bool {
+	if len(id) == 0 || id[len(id)-1] == ':' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case isIDChar(c) || c == ':':
+		case c == '%' && i+2 < len(id) && isHex(id[i+1]) && isHex(id[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Parse parses a DID or DID URL.
+func Parse(s string) (*DID, error) {
+	d := &DID{}
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s, d.Fragment = s[:i], s[i+1:]
+	}
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		s, d.Query = s[:i], s[i+1:]
+	}
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s, d.Path = s[:i], s[i:]
+	}
+
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] != "did" {
+		return nil, errors.New("Not a DID: " + s)
+	}
+	d.Method, d.ID = parts[1], parts[2]
+	if len(d.Method) == 0 {
+		return nil, errors.New("Empty DID method")
+	}
+	for i := 0; i < len(d.Method); i++ {
+		if !isMethodChar(d.Method[i]) {
+			return nil, errors.New("Invalid DID method: " + d.Method)
+		}
+	}
+	if !validID(d.ID) {
+		return nil, errors.New("Invalid DID method specific ID: " + d.ID)
+	}
+
+	return d, nil
+}
+
+// String returns the DID without any DID URL parts.
+func (d *DID) String() string {
+	return "did:" + d.Method + ":" + d.ID
+}
+
+// URL returns the DID URL, with path, query and fragment.
+func (d *DID) URL() string {
+	s := d.String() + d.Path
+	if len(d.Query) > 0 {
+		s += "?" + d.Query
+	}
+	if len(d.Fragment) > 0 {
+		s += "#" + d.Fragment
+	}
+	return s
+}
+
+// StringSet is a JSON value that is either a string or a list of strings,
+// as the DID Core controller property is.
+type StringSet []string
+
+func (s *StringSet) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*s = StringSet{one}
+		return nil
+	}
+	var many []string
+	err := json.Unmarshal(b, &many)
+	if err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+func (s StringSet) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]string(s))
+}
+
+// VerificationMethod is a public key of the DID subject. The key is given
+// in one of PublicKeyJwk, PublicKeyMultibase or, as older documents do,
+// PublicKeyHex.
+type VerificationMethod struct {
+	ID                 string          `json:"id"`
+	Type               string          `json:"type"`
+	Controller         string          `json:"controller"`
+	PublicKeyJwk       json.RawMessage `json:"publicKeyJwk,omitempty"`
+	PublicKeyMultibase string          `json:"publicKeyMultibase,omitempty"`
+	PublicKeyHex       string          `json:"publicKeyHex,omitempty"`
+}
+
+// Relationship is an entry of a verification relationship such as
+// authentication: either a reference to a verification method of the
+// document or a method embedded in place.
+type Relationship struct {
+	Ref      string
+	Embedded *VerificationMethod
+}
+
+func (r *Relationship) UnmarshalJSON(b []byte) error {
+	var ref string
+	if json.Unmarshal(b, &ref) == nil {
+		r.Ref = ref
+		return nil
+	}
+	r.Embedded = new(VerificationMethod)
+	return json.Unmarshal(b, r.Embedded)
+}
+
+func (r Relationship) MarshalJSON() ([]byte, error) {
+	if r.Embedded != nil {
+		return json.Marshal(r.Embedded)
+	}
+	return json.Marshal(r.Ref)
+}
+
+type Service struct {
+	ID              string          `json:"id"`
+	Type            StringSet       `json:"type"`
+	ServiceEndpoint json.RawMessage `json:"serviceEndpoint"`
+}
+
+// Document is a DID document as laid out by W3C DID Core.
+type Document struct {
+	Context              json.RawMessage      `json:"@context,omitempty"`
+	ID                   string               `json:"id"`
+	Controller           StringSet            `json:"controller,omitempty"`
+	AlsoKnownAs          []string             `json:"alsoKnownAs,omitempty"`
+	VerificationMethod   []VerificationMethod `json:"verificationMethod,omitempty"`
+	Authentication       []Relationship       `json:"authentication,omitempty"`
+	AssertionMethod      []Relationship       `json:"assertionMethod,omitempty"`
+	KeyAgreement         []Relationship       `json:"keyAgreement,omitempty"`
+	CapabilityInvocation []Relationship       `json:"capabilityInvocation,omitempty"`
+	CapabilityDelegation []Relationship       `json:"capabilityDelegation,omitempty"`
+	Service              []Service            `json:"service,omitempty"`
+}
+
+// ParseDocument reads a DID document and checks that its ID is a DID.
+func ParseDocument(b []byte) (*Document, error) {
+	var doc Document
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if d.URL() != d.String() {
+		return nil, errors.New("Document ID is a DID URL: " + doc.ID)
+	}
+
+	return &doc, nil
+}
+
+// absolute resolves a reference relative to the document, like #key-1.
+func (doc *Document) absolute(ref string) string {
+	if strings.HasPrefix(ref, "#") {
+		return doc.ID + ref
+	}
+	return ref
+}
+
+// Method returns the verification method with the given ID, which may be
+// relative to the document.
+func (doc *Document) Method(id string) (*VerificationMethod, error) {
+	id = doc.absolute(id)
+	for i := range doc.VerificationMethod {
+		if doc.absolute(doc.VerificationMethod[i].ID) == id {
+			return &doc.VerificationMethod[i], nil
+		}
+	}
+	return nil, errors.New("No verification method " + id)
+}
+
+// Methods resolves the entries of a verification relationship.
+func (doc *Document) Methods(rel []Relationship) ([]*VerificationMethod, error) {
+	vms := make([]*VerificationMethod, 0, len(rel))
+	for _, r := range rel {
+		if r.Embedded != nil {
+			vms = append(vms, r.Embedded)
+			continue
+		}
+		vm, err := doc.Method(r.Ref)
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+// PublicKey returns the key of the method in the uncompressed form the keys
+// package uses. Only P-256 keys are supported.
+func (vm *VerificationMethod) PublicKey() ([]byte, error) {
+	switch {
+	case len(vm.PublicKeyJwk) > 0:
+		return keys.ImportPublic(vm.PublicKeyJwk, keys.FormatJWK)
+	case len(vm.PublicKeyMultibase) > 0:
+		return decodeMultibaseKey(vm.PublicKeyMultibase)
+	case len(vm.PublicKeyHex) > 0:
+		b, err := hex.DecodeString(vm.PublicKeyHex)
+		if err != nil {
+			return nil, err
+		}
+		return keys.ImportPublic(b, keys.FormatRaw)
+	}
+	return nil, errors.New("No public key in verification method " + vm.ID)
+}
+
+// Address returns the account address of the method's key.
+func (vm *VerificationMethod) Address() (string, error) {
+	pubKey, err := vm.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	return keys.DeriveAddress(pubKey), nil
+}
+
+// Authenticate checks that sig is a signature of msg by one of the keys the
+// DID subject authenticates with, and returns that key's method.
+func (doc *Document) Authenticate(msg, sig []byte) (*VerificationMethod, error) {
+	vms, err := doc.Methods(doc.Authentication)
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vms {
+		pubKey, err := vm.PublicKey()
+		if err != nil {
+			continue
+		}
+		if keys.Verify(pubKey, msg, sig) {
+			return vm, nil
+		}
+	}
+	return nil, errors.New("Signature matches no authentication key of " + doc.ID)
+}
+
+// Resolve fetches the document of a DID from the chain.
+func Resolve(ctx context.Context, did string) (*Document, error) {
+	d, err := Parse(did)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rpc.GetDID(ctx, d.String())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParseDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	if doc.ID != d.String() {
+		return nil, errors.New("Got the document of " + doc.ID + " for " + d.String())
+	}
+
+	return doc, nil
+}
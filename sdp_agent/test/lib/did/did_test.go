@@ -0,0 +1,157 @@
+package did
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+func TestParse(t *testing.T) {
+	d, err := Parse("did:amo:A7E7A6E63DB1CBFB/path?service=sdp#key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "amo", d.Method)
+	assert.Equal(t, "A7E7A6E63DB1CBFB", d.ID)
+	assert.Equal(t, "/path", d.Path)
+	assert.Equal(t, "service=sdp", d.Query)
+	assert.Equal(t, "key-1", d.Fragment)
+	assert.Equal(t, "did:amo:A7E7A6E63DB1CBFB", d.String())
+	assert.Equal(t, "did:amo:A7E7A6E63DB1CBFB/path?service=sdp#key-1", d.URL())
+
+	d, err = Parse("did:web:rsu.example.com:corridor%3A7:unit-12")
+	assert.NoError(t, err)
+	assert.Equal(t, "rsu.example.com:corridor%3A7:unit-12", d.ID)
+
+	for _, bad := range []string{
+		"",
+		"amo:1234",
+		"did:amo",
+		"did::1234",
+		"did:AMO:1234",
+		"did:amo:",
+		"did:amo:12:",
+		"did:amo:12 34",
+		"did:amo:12%3",
+	} {
+		_, err = Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMultibase(t *testing.T) {
+	// P-256 did:key example from the did:key method spec
+	const example = "zDnaerDaTF5BXEavCrfRZEk316dpbLsfPDZ3WJ5hRTPFU2169"
+	pubKey, err := decodeMultibaseKey(example)
+	assert.NoError(t, err)
+	assert.Equal(t, 65, len(pubKey))
+	mb, err := MultibaseKey(pubKey)
+	assert.NoError(t, err)
+	assert.Equal(t, example, mb)
+
+	_, err = decodeMultibaseKey("f" + example[1:])
+	assert.Error(t, err)
+	_, err = decodeMultibaseKey("z0OIl")
+	assert.Error(t, err)
+}
+
+func TestDocument(t *testing.T) {
+	jwkKey, _ := keys.GenerateKey("", nil, false)
+	mbKey, _ := keys.GenerateKey("", nil, false)
+	hexKey, _ := keys.GenerateKey("", nil, false)
+	otherKey, _ := keys.GenerateKey("", nil, false)
+	jwk, err := jwkKey.ExportPublic(keys.FormatJWK)
+	assert.NoError(t, err)
+	mb, err := MultibaseKey(mbKey.PubKey)
+	assert.NoError(t, err)
+
+	id := "did:amo:" + jwkKey.Address
+	raw, err := json.Marshal(map[string]interface{}{
+		"@context":   []string{"https://www.w3.org/ns/did/v1"},
+		"id":         id,
+		"controller": id,
+		"verificationMethod": []interface{}{
+			map[string]interface{}{
+				"id":           "#key-1",
+				"type":         "JsonWebKey2020",
+				"controller":   id,
+				"publicKeyJwk": json.RawMessage(jwk),
+			},
+			map[string]interface{}{
+				"id":                 id + "#key-2",
+				"type":               "Multikey",
+				"controller":         id,
+				"publicKeyMultibase": mb,
+			},
+		},
+		"authentication": []interface{}{
+			"#key-1",
+			id + "#key-2",
+			map[string]interface{}{
+				"id":           id + "#key-3",
+				"type":         "EcdsaSecp256r1VerificationKey2019",
+				"controller":   id,
+				"publicKeyHex": hex.EncodeToString(hexKey.PubKey),
+			},
+		},
+		"service": []interface{}{
+			map[string]interface{}{
+				"id":              "#sdp",
+				"type":            "SDPController",
+				"serviceEndpoint": "https://sdp.example.com",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	doc, err := ParseDocument(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, StringSet{id}, doc.Controller)
+	assert.Equal(t, StringSet{"SDPController"}, doc.Service[0].Type)
+
+	vm, err := doc.Method(id + "#key-1")
+	assert.NoError(t, err)
+	address, err := vm.Address()
+	assert.NoError(t, err)
+	assert.Equal(t, jwkKey.Address, address)
+	vm, err = doc.Method("#key-2")
+	assert.NoError(t, err)
+	pubKey, err := vm.PublicKey()
+	assert.NoError(t, err)
+	assert.Equal(t, mbKey.PubKey, pubKey)
+	_, err = doc.Method("#key-3")
+	assert.Error(t, err)
+
+	msg := []byte("rsu handshake")
+	for i, key := range []*keys.KeyEntry{jwkKey, mbKey, hexKey} {
+		sig, err := key.Sign(msg)
+		assert.NoError(t, err)
+		vm, err := doc.Authenticate(msg, sig)
+		assert.NoError(t, err)
+		address, err := vm.Address()
+		assert.NoError(t, err)
+		assert.Equal(t, key.Address, address, i)
+	}
+	sig, _ := otherKey.Sign(msg)
+	_, err = doc.Authenticate(msg, sig)
+	assert.Error(t, err)
+
+	// round trip keeps references and embedded methods apart
+	b, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	doc2, err := ParseDocument(b)
+	assert.NoError(t, err)
+	assert.Equal(t, doc.Authentication, doc2.Authentication)
+
+	// a dangling reference
+	doc.Authentication = append(doc.Authentication, Relationship{Ref: "#key-9"})
+	_, err = doc.Authenticate(msg, sig)
+	assert.Error(t, err)
+
+	_, err = ParseDocument([]byte(`{"id":"did:amo:1234#key-1"}`))
+	assert.Error(t, err)
+	_, err = ParseDocument([]byte(`{"id":"1234"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package did
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// A publicKeyMultibase of a Multikey is base58btc, marked by a leading 'z',
+// of the multicodec varint of the key type followed by the compressed key.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// varint of the p256-pub multicodec, 0x1200
+var p256Codec = []byte{0x80, 0x24}
+
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	zeros := 0
+	for i := 0; i < len(s) && s[i] == base58Alphabet[0]; i++ {
+		zeros++
+	}
+	for i := 0; i < len(s); i++ {
+		d := bytes.IndexByte([]byte(base58Alphabet), s[i])
+		if d < 0 {
+			return nil, errors.New("Invalid base58 character")
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// MultibaseKey encodes a P-256 public key as a Multikey publicKeyMultibase.
+func MultibaseKey(pubKey []byte) (string, error) {
+	compressed, err := keys.CompressPubKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return "z" + base58Encode(append(append([]byte{}, p256Codec...), compressed...)), nil
+}
+
+func decodeMultibaseKey(s string) ([]byte, error) {
+	if len(s) == 0 || s[0] != 'z' {
+		return nil, errors.New("Only base58btc multibase keys are supported")
+	}
+	b, err := base58Decode(s[1:])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, p256Codec) {
+		return nil, errors.New("Not a P-256 multikey")
+	}
+	return keys.DecompressPubKey(b[len(p256Codec):])
+}
@@ -0,0 +1,198 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+// Parcels are encrypted with a random AES-256 data key in fixed-size
+// segments, each sealed with AES-GCM. The nonce of a segment is the random
+// prefix from the header, the segment counter and a flag marking the last
+// segment, so reordering, truncation and extension are all detected while
+// neither side ever holds more than one segment in memory.
+//
+//	header:  version(1) | nonce prefix(7)
+//	segment: AES-GCM(plain[SegmentSize]) | tag(16)
+const (
+	SegmentSize = 64 << 10
+	KeySize     = 32
+
+	version    = 0x01
+	prefixSize = 7
+	headerSize = 1 + prefixSize
+	tagSize    = 16
+)
+
+// NewDataKey returns a fresh random data key.
+func NewDataKey() ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != KeySize {
+		return nil, errors.New("Wrong data key size")
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// readSegment fills buf from r and reports whether it is the last segment
+// of the stream.
+func readSegment(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	_, err = r.Peek(1)
+	if err == io.EOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
+
+// Encrypt reads plain data from r and writes the encrypted parcel to w.
+func Encrypt(w io.Writer, r io.Reader, dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, headerSize)
+	header[0] = version
+	_, err = rand.Read(header[1:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(r, SegmentSize)
+	plain := make([]byte, SegmentSize)
+	sealed := make([]byte, 0, SegmentSize+tagSize)
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readSegment(br, plain)
+		if err != nil {
+			return err
+		}
+		nonce := segmentNonce(header[1:], counter, last)
+		sealed = aead.Seal(sealed[:0], nonce, plain[:n], nil)
+		_, err = w.Write(sealed)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == ^uint32(0) {
+			return errors.New("Parcel too large")
+		}
+	}
+}
+
+// Decrypt reads an encrypted parcel from r and writes the plain data to w.
+// Data written before an error is returned must be discarded by the caller.
+func Decrypt(w io.Writer, r io.Reader, dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, headerSize)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return errors.New("Encrypted parcel too short")
+	}
+	if header[0] != version {
+		return errors.New("Unknown encrypted parcel version")
+	}
+
+	br := bufio.NewReaderSize(r, SegmentSize+tagSize)
+	sealed := make([]byte, SegmentSize+tagSize)
+	plain := make([]byte, 0, SegmentSize)
+	for counter := uint32(0); ; counter++ {
+		n, last, err := readSegment(br, sealed)
+		if err != nil {
+			return err
+		}
+		nonce := segmentNonce(header[1:], counter, last)
+		plain, err = aead.Open(plain[:0], nonce, sealed[:n], nil)
+		if err != nil {
+			return errors.New("Encrypted parcel is corrupted or truncated")
+		}
+		_, err = w.Write(plain)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// NewEncryptingReader returns a reader yielding the encrypted form of r.
+func NewEncryptingReader(r io.Reader, dataKey []byte) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Encrypt(pw, r, dataKey))
+	}()
+	return pr
+}
+
+// Custody wraps a data key to the recipient's public key. The result is what
+// a parcel owner registers or grants on chain.
+func Custody(dataKey []byte, recipientPubKey []byte) ([]byte, error) {
+	if len(dataKey) != KeySize {
+		return nil, errors.New("Wrong data key size")
+	}
+	return keys.SealTo(recipientPubKey, dataKey)
+}
+
+// OpenCustody recovers the data key from a custody issued to key.
+func OpenCustody(custody []byte, key *keys.KeyEntry) ([]byte, error) {
+	dataKey, err := key.Open(custody)
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != KeySize {
+		return nil, errors.New("Wrong data key size")
+	}
+	return dataKey, nil
+}
+
+// Regrant re-wraps the data key in the owner's custody to another recipient,
+// as needed when granting a parcel.
+func Regrant(custody []byte, owner *keys.KeyEntry, recipientPubKey []byte) ([]byte, error) {
+	dataKey, err := OpenCustody(custody, owner)
+	if err != nil {
+		return nil, err
+	}
+	return Custody(dataKey, recipientPubKey)
+}
@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dataKey, err := NewDataKey()
+	assert.NoError(t, err)
+
+	for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3 * SegmentSize} {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+		var enc bytes.Buffer
+		err = Encrypt(&enc, bytes.NewReader(plain), dataKey)
+		assert.NoError(t, err)
+
+		var dec bytes.Buffer
+		err = Decrypt(&dec, bytes.NewReader(enc.Bytes()), dataKey)
+		assert.NoError(t, err, "size %d", size)
+		assert.Equal(t, size, dec.Len())
+		assert.True(t, bytes.Equal(plain, dec.Bytes()), "size %d", size)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	dataKey, err := NewDataKey()
+	assert.NoError(t, err)
+	plain := bytes.Repeat([]byte{0xab}, 2*SegmentSize)
+	var enc bytes.Buffer
+	err = Encrypt(&enc, bytes.NewReader(plain), dataKey)
+	assert.NoError(t, err)
+	b := enc.Bytes()
+
+	var dec bytes.Buffer
+	// truncated at a segment boundary
+	err = Decrypt(&dec, bytes.NewReader(b[:headerSize+SegmentSize+tagSize]), dataKey)
+	assert.Error(t, err)
+
+	// flipped bit
+	broken := append([]byte{}, b...)
+	broken[headerSize+10] ^= 1
+	err = Decrypt(&dec, bytes.NewReader(broken), dataKey)
+	assert.Error(t, err)
+
+	// extended
+	err = Decrypt(&dec, bytes.NewReader(append(b, 0)), dataKey)
+	assert.Error(t, err)
+
+	// wrong key
+	otherKey, err := NewDataKey()
+	assert.NoError(t, err)
+	err = Decrypt(&dec, bytes.NewReader(b), otherKey)
+	assert.Error(t, err)
+}
+
+func TestCustody(t *testing.T) {
+	u1, err := keys.GenerateKey("u1", nil, false)
+	assert.NoError(t, err)
+	u2, err := keys.GenerateKey("u2", nil, false)
+	assert.NoError(t, err)
+
+	dataKey, err := NewDataKey()
+	assert.NoError(t, err)
+	custody, err := Custody(dataKey, u1.PubKey)
+	assert.NoError(t, err)
+
+	got, err := OpenCustody(custody, u1)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, got)
+
+	_, err = OpenCustody(custody, u2)
+	assert.Error(t, err)
+
+	granted, err := Regrant(custody, u1, u2.PubKey)
+	assert.NoError(t, err)
+	got, err = OpenCustody(granted, u2)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, got)
+
+	// encrypted keys must be unlocked first
+	u3, err := keys.GenerateKey("u3", []byte("pass"), true)
+	assert.NoError(t, err)
+	custody, err = Custody(dataKey, u3.PubKey)
+	assert.NoError(t, err)
+	_, err = OpenCustody(custody, u3)
+	assert.Error(t, err)
+	assert.NoError(t, u3.Decrypt([]byte("pass")))
+	got, err = OpenCustody(custody, u3)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, got)
+
+	_, err = Custody(dataKey, []byte{0x04, 1, 2, 3})
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// BroadcastTx sends a signed transaction and waits until it is committed.
+// It fails if the transaction is rejected on check or on delivery. On a dry
+// run the transaction is only printed and the result is nil.
+func BroadcastTx(ctx context.Context, tx []byte) (*ctypes.ResultBroadcastTxCommit, error) {
+	if DryRun {
+		fmt.Println("tx:", string(tx))
+		return nil, nil
+	}
+	t, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.BroadcastTxCommit(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if res.CheckTx.IsErr() {
+		return res, errors.New("Tx rejected: " + res.CheckTx.Log)
+	}
+	if res.DeliverTx.IsErr() {
+		return res, errors.New("Tx failed: " + res.DeliverTx.Log)
+	}
+
+	return res, nil
+}
+
+// LastHeight returns the height of the latest block, which transactions
+// carry to bound how long they can be replayed. It is 0 on a dry run.
+func LastHeight(ctx context.Context) (int64, error) {
+	if DryRun {
+		return 0, nil
+	}
+	t, err := getTransport()
+	if err != nil {
+		return 0, err
+	}
+	status, err := t.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return status.SyncInfo.LatestBlockHeight, nil
+}
@@ -0,0 +1,39 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestBroadcastTx(t *testing.T) {
+	vals, privVals := tmtypes.RandValidatorSet(1, 10)
+	m := newMockNode(vals, privVals, testState)
+	defer m.Close()
+	RpcRemote = m.URL()
+
+	res, err := BroadcastTx(context.Background(), []byte(`{"type":"transfer"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, m.height, res.Height)
+	assert.Equal(t, 1, len(m.txs))
+
+	_, err = BroadcastTx(context.Background(), []byte(`transfer`))
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(m.txs))
+
+	// the caller gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = BroadcastTx(ctx, []byte(`{"type":"transfer"}`))
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(m.txs))
+
+	DryRun = true
+	defer func() { DryRun = false }()
+	res, err = BroadcastTx(context.Background(), []byte(`{"type":"transfer"}`))
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, 1, len(m.txs))
+}
@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmcrypto "github.com/tendermint/tendermint/proto/tendermint/crypto"
+	tmclient "github.com/tendermint/tendermint/rpc/client"
+	tmhttp "github.com/tendermint/tendermint/rpc/client/http"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// CacheStats counts what a Cache did since it was made.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Entries       int
+	Height        int64
+}
+
+type cacheEntry struct {
+	key string
+	res ctypes.ResultABCIQuery
+}
+
+// Cache is a Transport that keeps answers to ABCI queries until the chain
+// moves on. The node behind it is asked for a query only the first time it
+// is made in a block; when a higher block is seen, every answer is dropped.
+// New blocks are learnt from the heights answers come with, and from
+// Start or Subscribe. At most maxEntries answers are kept, the least
+// recently used going first.
+type Cache struct {
+	Transport
+
+	mtx        sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	height     int64
+	generation uint64
+	stats      CacheStats
+	stop       chan struct{}
+}
+
+func NewCache(t Transport, maxEntries int) (*Cache, error) {
+	if t == nil {
+		return nil, errors.New("No transport to cache")
+	}
+	if maxEntries <= 0 {
+		return nil, errors.New("Cache size must be positive")
+	}
+	return &Cache{
+		Transport:  t,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}, nil
+}
+
+// copyResult copies an answer down to its byte slices, so that callers
+// cannot change what the cache hands out to others.
+func copyResult(res *ctypes.ResultABCIQuery) ctypes.ResultABCIQuery {
+	cp := *res
+	cp.Response.Key = copyBytes(res.Response.Key)
+	cp.Response.Value = copyBytes(res.Response.Value)
+	if res.Response.ProofOps != nil {
+		ops := make([]tmcrypto.ProofOp, len(res.Response.ProofOps.Ops))
+		for i, op := range res.Response.ProofOps.Ops {
+			ops[i] = tmcrypto.ProofOp{
+				Type: op.Type,
+				Key:  copyBytes(op.Key),
+				Data: copyBytes(op.Data),
+			}
+		}
+		cp.Response.ProofOps = &tmcrypto.ProofOps{Ops: ops}
+	}
+	return cp
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cacheKey(path string, data []byte, opts tmclient.ABCIQueryOptions) string {
+	return path + "?" + hex.EncodeToString(data) +
+		"@" + strconv.FormatInt(opts.Height, 10) +
+		"/" + strconv.FormatBool(opts.Prove)
+}
+
+// Invalidate drops every answer if height is above the last one seen.
+func (c *Cache) Invalidate(height int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.invalidate(height)
+}
+
+func (c *Cache) invalidate(height int64) {
+	if height <= c.height {
+		return
+	}
+	c.height = height
+	c.generation++
+	if c.lru.Len() > 0 {
+		c.entries = make(map[string]*list.Element)
+		c.lru.Init()
+		c.stats.Invalidations++
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Height = c.height
+	return stats
+}
+
+func (c *Cache) ABCIQueryWithOptions(ctx context.Context, path string, data tmbytes.HexBytes,
+	opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	key := cacheKey(path, data, opts)
+
+	c.mtx.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.stats.Hits++
+		res := copyResult(&elem.Value.(*cacheEntry).res)
+		c.mtx.Unlock()
+		return &res, nil
+	}
+	c.stats.Misses++
+	generation := c.generation
+	c.mtx.Unlock()
+
+	res, err := c.Transport.ABCIQueryWithOptions(ctx, path, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.invalidate(res.Response.Height)
+	// Answers at a given height never change. Others must not be older than
+	// the latest block seen, or predate it if the app leaves height out.
+	stale := res.Response.Height < c.height
+	if res.Response.Height == 0 {
+		stale = generation != c.generation
+	}
+	if opts.Height != 0 {
+		stale = false
+	}
+	if stale || res.Response.IsErr() {
+		return res, nil
+	}
+	if _, ok := c.entries[key]; ok {
+		return res, nil
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, res: copyResult(res)})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+
+	return res, nil
+}
+
+// Poll asks the node for the latest height once.
+func (c *Cache) Poll(ctx context.Context) error {
+	status, err := c.Transport.Status(ctx)
+	if err != nil {
+		return err
+	}
+	c.Invalidate(status.SyncInfo.LatestBlockHeight)
+	return nil
+}
+
+// Start polls the node every interval until Stop. Block times are a few
+// seconds, so an interval of a second or less keeps answers fresh.
+func (c *Cache) Start(interval time.Duration) {
+	c.mtx.Lock()
+	if c.stop != nil {
+		c.mtx.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mtx.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				c.Poll(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+func (c *Cache) Stop() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Subscribe invalidates the cache on every new block header the node at
+// remote announces over its websocket, until ctx is done. It saves the
+// polling, but only works with a node that allows subscriptions.
+func (c *Cache) Subscribe(ctx context.Context, remote string) error {
+	client, err := tmhttp.New(remote, "/websocket")
+	if err != nil {
+		return err
+	}
+	err = client.Start()
+	if err != nil {
+		return err
+	}
+	query := tmtypes.QueryForEvent(tmtypes.EventNewBlockHeader).String()
+	events, err := client.Subscribe(ctx, "rpc-cache", query)
+	if err != nil {
+		client.Stop()
+		return err
+	}
+
+	go func() {
+		defer client.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if data, ok := ev.Data.(tmtypes.EventDataNewBlockHeader); ok {
+					c.Invalidate(data.Header.Height)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
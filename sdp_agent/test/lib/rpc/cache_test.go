@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func setUpCache(t *testing.T, maxEntries int) (*mockNode, *Cache) {
+	vals, privVals := tmtypes.RandValidatorSet(4, 10)
+	m := newMockNode(vals, privVals, testState)
+	node, err := NewNode(m.URL())
+	assert.NoError(t, err)
+	cache, err := NewCache(node, maxEntries)
+	assert.NoError(t, err)
+	SetTransport(cache)
+	t.Cleanup(func() {
+		SetTransport(nil)
+		cache.Stop()
+		m.Close()
+	})
+	return m, cache
+}
+
+func TestCache(t *testing.T) {
+	m, cache := setUpCache(t, 2)
+
+	for i := 0; i < 3; i++ {
+		res, err := QueryParcel(context.Background(), "AB01")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	}
+	assert.Equal(t, 1, m.Calls())
+	stats := cache.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, m.height, stats.Height)
+
+	// keyed by params
+	res, err := QueryParcel(context.Background(), "AB02")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"EF01"}`, string(res))
+	assert.Equal(t, 2, m.Calls())
+
+	// least recently used goes first
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	_, err = QueryParcel(context.Background(), "FFFF")
+	assert.NoError(t, err)
+	stats = cache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, m.Calls())
+	_, err = QueryParcel(context.Background(), "AB02")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, m.Calls())
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	m, cache := setUpCache(t, 16)
+
+	_, err := QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.Calls())
+
+	// same block
+	err = cache.Poll(context.Background())
+	assert.NoError(t, err)
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.Calls())
+
+	// new block
+	m.mtx.Lock()
+	m.height++
+	m.mtx.Unlock()
+	err = cache.Poll(context.Background())
+	assert.NoError(t, err)
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Invalidations)
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, m.height, stats.Height)
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, m.Calls())
+
+	// an answer from a newer block drops older ones
+	cache.Invalidate(m.height - 5)
+	assert.Equal(t, 1, cache.Stats().Entries)
+	m.mtx.Lock()
+	m.height++
+	m.mtx.Unlock()
+	_, err = QueryParcel(context.Background(), "AB02")
+	assert.NoError(t, err)
+	stats = cache.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Invalidations)
+}
+
+func TestCacheCopies(t *testing.T) {
+	m, _ := setUpCache(t, 16)
+
+	res, err := QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	res[0] = 'X'
+	res, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	res[0] = 'X'
+	res, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	assert.Equal(t, 1, m.Calls())
+}
@@ -0,0 +1,239 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+// The Get* functions are typed counterparts of the Query* functions. They
+// decode the query result and report an empty result as ErrNotFound. The raw
+// functions stay for callers that want to pass the JSON through untouched.
+
+var (
+	ErrNotFound = errors.New("not found")
+	// returned instead of a result when DryRun is set
+	ErrDryRun = errors.New("dry run")
+)
+
+type AppVersion struct {
+	AppVersion           string   `json:"app_version,omitempty"`
+	AppProtocolVersions  []uint64 `json:"app_protocol_versions,omitempty"`
+	StateProtocolVersion uint64   `json:"state_protocol_version,omitempty"`
+	AppProtocolVersion   uint64   `json:"app_protocol_version,omitempty"`
+}
+
+func isEmpty(res []byte) bool {
+	return len(res) == 0 || string(res) == "null"
+}
+
+// getTyped runs query and decodes its result into v.
+func getTyped(ctx context.Context, query func(context.Context) ([]byte, error), v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	res, err := query(ctx)
+	if err != nil {
+		return err
+	}
+	if DryRun {
+		return ErrDryRun
+	}
+	if isEmpty(res) {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(res, v)
+}
+
+func GetAppVersion(ctx context.Context) (*AppVersion, error) {
+	var appVersion AppVersion
+	err := getTyped(ctx, QueryAppVersion, &appVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &appVersion, nil
+}
+
+func GetAppConfig(ctx context.Context) (*types.AMOAppConfig, error) {
+	var appConfig types.AMOAppConfig
+	err := getTyped(ctx, QueryAppConfig, &appConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &appConfig, nil
+}
+
+// GetBalance never returns ErrNotFound; an unknown account has zero balance.
+func GetBalance(ctx context.Context, udc uint32, address string) (*types.Currency, error) {
+	var balance types.Currency
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryBalance(ctx, udc, address)
+	}, &balance)
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+func GetUDC(ctx context.Context, udcID string) (*types.UDC, error) {
+	var udc types.UDC
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryUDC(ctx, udcID)
+	}, &udc)
+	if err != nil {
+		return nil, err
+	}
+	return &udc, nil
+}
+
+func GetUDCLock(ctx context.Context, udcID, address string) (*types.Currency, error) {
+	var amount types.Currency
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryUDCLock(ctx, udcID, address)
+	}, &amount)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
+
+func GetStake(ctx context.Context, address string) (*types.Stake, error) {
+	var stake types.Stake
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryStake(ctx, address)
+	}, &stake)
+	if err != nil {
+		return nil, err
+	}
+	return &stake, nil
+}
+
+func GetDelegate(ctx context.Context, address string) (*types.Delegate, error) {
+	var delegate types.Delegate
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryDelegate(ctx, address)
+	}, &delegate)
+	if err != nil {
+		return nil, err
+	}
+	return &delegate, nil
+}
+
+func GetDraft(ctx context.Context, draftID string) (*types.DraftEx, error) {
+	var draft types.DraftEx
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryDraft(ctx, draftID)
+	}, &draft)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Draft == nil {
+		return nil, ErrNotFound
+	}
+	return &draft, nil
+}
+
+func GetVote(ctx context.Context, draftID, address string) (*types.Vote, error) {
+	var vote types.Vote
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryVote(ctx, draftID, address)
+	}, &vote)
+	if err != nil {
+		return nil, err
+	}
+	return &vote, nil
+}
+
+func GetStorage(ctx context.Context, storageID string) (*types.Storage, error) {
+	var storage types.Storage
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryStorage(ctx, storageID)
+	}, &storage)
+	if err != nil {
+		return nil, err
+	}
+	return &storage, nil
+}
+
+func GetParcel(ctx context.Context, parcelID string) (*types.ParcelEx, error) {
+	var parcel types.ParcelEx
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryParcel(ctx, parcelID)
+	}, &parcel)
+	if err != nil {
+		return nil, err
+	}
+	return &parcel, nil
+}
+
+func GetRequest(ctx context.Context, target, recipient string) (*types.Request, error) {
+	var request types.Request
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryRequest(ctx, target, recipient)
+	}, &request)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func GetUsage(ctx context.Context, target, recipient string) (*types.Usage, error) {
+	var usage types.Usage
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryUsage(ctx, target, recipient)
+	}, &usage)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func GetDID(ctx context.Context, did string) (json.RawMessage, error) {
+	var doc json.RawMessage
+	err := getTyped(ctx, func(ctx context.Context) ([]byte, error) {
+		return QueryDID(ctx, did)
+	}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DraftItem is a draft with the ID it was queried by.
+type DraftItem struct {
+	ID    uint32
+	Draft *types.DraftEx
+}
+
+// GetDrafts returns up to limit drafts with IDs from from on, skipping those
+// keep returns false for, and the ID to continue from. Draft IDs are given
+// out in sequence, so the first missing ID ends the list and next is 0.
+func GetDrafts(ctx context.Context, from uint32, limit int, keep func(*types.DraftEx) bool) ([]DraftItem, uint32, error) {
+	if limit < 1 {
+		return nil, 0, errors.New("Limit must be at least 1")
+	}
+	var drafts []DraftItem
+	for id := from; ; id++ {
+		if len(drafts) == limit {
+			return drafts, id, nil
+		}
+		draft, err := GetDraft(ctx, strconv.FormatUint(uint64(id), 10))
+		if err == ErrNotFound {
+			return drafts, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if keep == nil || keep(draft) {
+			drafts = append(drafts, DraftItem{ID: id, Draft: draft})
+		}
+	}
+}
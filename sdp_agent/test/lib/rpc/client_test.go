@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmclient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+func TestGetDrafts(t *testing.T) {
+	vals, privVals := tmtypes.RandValidatorSet(1, 10)
+	m := newMockNode(vals, privVals, map[string][]byte{
+		"/draft:1": []byte(`{"proposer":"AB","close_count":0,"votes":[]}`),
+		"/draft:2": []byte(`{"proposer":"CD","close_count":5,"votes":[]}`),
+		"/draft:3": []byte(`{"proposer":"EF","open_count":3,"votes":[]}`),
+		"/draft:4": []byte(`{"proposer":"01","close_count":1,"votes":[]}`),
+	})
+	defer m.Close()
+	RpcRemote = m.URL()
+	ctx := context.Background()
+
+	draft, err := GetDraft(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), draft.CloseCount)
+	_, err = GetDraft(ctx, "9")
+	assert.Equal(t, ErrNotFound, err)
+
+	open := func(d *types.DraftEx) bool {
+		return d.OpenCount > 0 || d.CloseCount > 0
+	}
+	drafts, next, err := GetDrafts(ctx, 1, 2, open)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(drafts))
+	assert.Equal(t, uint32(2), drafts[0].ID)
+	assert.Equal(t, uint32(3), drafts[1].ID)
+	assert.Equal(t, uint32(4), next)
+
+	drafts, next, err = GetDrafts(ctx, next, 2, open)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(drafts))
+	assert.Equal(t, uint32(4), drafts[0].ID)
+	assert.Equal(t, uint32(0), next)
+
+	drafts, _, err = GetDrafts(ctx, 1, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(drafts))
+
+	_, _, err = GetDrafts(ctx, 1, 0, nil)
+	assert.Error(t, err)
+	_, _, err = GetDrafts(ctx, 1, -1, nil)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = GetDraft(ctx, "1")
+	assert.Equal(t, context.Canceled, err)
+}
+
+// stuckNode answers nothing until the query is cancelled.
+type stuckNode struct {
+	Transport
+	cancelled chan struct{}
+}
+
+func (n *stuckNode) ABCIQueryWithOptions(ctx context.Context, path string, data tmbytes.HexBytes,
+	opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	<-ctx.Done()
+	close(n.cancelled)
+	return nil, ctx.Err()
+}
+
+func TestGetCancel(t *testing.T) {
+	n := &stuckNode{cancelled: make(chan struct{})}
+	SetTransport(n)
+	defer SetTransport(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := GetDraft(ctx, "1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// the query itself was called off, not left running
+	select {
+	case <-n.cancelled:
+	default:
+		t.Fatal("query still running")
+	}
+}
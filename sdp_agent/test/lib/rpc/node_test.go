@@ -0,0 +1,229 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tmcrypto "github.com/tendermint/tendermint/proto/tendermint/crypto"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmversion "github.com/tendermint/tendermint/proto/tendermint/version"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tendermint/version"
+)
+
+const testChainID = "amo-testnet"
+
+// mockNode is a Tendermint RPC endpoint in front of a fixed app state. The
+// state is committed to in a simple merkle tree whose root is the app hash
+// of every block, and every block is signed by vals.
+type mockNode struct {
+	mtx      sync.Mutex
+	vals     *tmtypes.ValidatorSet
+	privVals []tmtypes.PrivValidator
+	height   int64
+	state    map[string][]byte
+	root     []byte
+	proofs   map[string]*merkle.Proof
+	lie      bool // answer with values that do not match the proofs
+	down     bool // answer every call with an error
+	calls    int
+	txs      [][]byte
+	server   *httptest.Server
+}
+
+func newMockNode(vals *tmtypes.ValidatorSet, privVals []tmtypes.PrivValidator, state map[string][]byte) *mockNode {
+	m := &mockNode{
+		vals:     vals,
+		privVals: privVals,
+		height:   10,
+		state:    state,
+		proofs:   make(map[string]*merkle.Proof),
+	}
+	var keys []string
+	for k := range state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([][]byte, len(keys))
+	for i, k := range keys {
+		items[i] = kvLeaf([]byte(k), state[k])
+	}
+	root, proofs := merkle.ProofsFromByteSlices(items)
+	m.root = root
+	for i, k := range keys {
+		m.proofs[k] = proofs[i]
+	}
+	m.server = httptest.NewServer(m)
+	return m
+}
+
+// kvLeaf is the leaf merkle.ValueOp expects for key and value.
+func kvLeaf(key, value []byte) []byte {
+	var b bytes.Buffer
+	buf := make([]byte, binary.MaxVarintLen64)
+	vhash := tmhash.Sum(value)
+	b.Write(buf[:binary.PutUvarint(buf, uint64(len(key)))])
+	b.Write(key)
+	b.Write(buf[:binary.PutUvarint(buf, uint64(len(vhash)))])
+	b.Write(vhash)
+	return b.Bytes()
+}
+
+func (m *mockNode) Close() {
+	m.server.Close()
+}
+
+func (m *mockNode) Calls() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.calls
+}
+
+func (m *mockNode) URL() string {
+	return m.server.URL
+}
+
+func (m *mockNode) signedHeader(height int64) (*tmtypes.SignedHeader, error) {
+	header := &tmtypes.Header{
+		Version:            tmversion.Consensus{Block: version.BlockProtocol},
+		ChainID:            testChainID,
+		Height:             height,
+		Time:               time.Unix(1600000000+height, 0).UTC(),
+		AppHash:            m.root,
+		ValidatorsHash:     m.vals.Hash(),
+		NextValidatorsHash: m.vals.Hash(),
+		ProposerAddress:    m.vals.Validators[0].Address,
+	}
+	blockID := tmtypes.BlockID{
+		Hash: header.Hash(),
+		PartSetHeader: tmtypes.PartSetHeader{
+			Total: 1,
+			Hash:  tmhash.Sum([]byte("parts")),
+		},
+	}
+	voteSet := tmtypes.NewVoteSet(testChainID, height, 0, tmproto.PrecommitType, m.vals)
+	commit, err := tmtypes.MakeCommit(blockID, height, 0, voteSet, m.privVals, header.Time)
+	if err != nil {
+		return nil, err
+	}
+	return &tmtypes.SignedHeader{Header: header, Commit: commit}, nil
+}
+
+func (m *mockNode) abciQuery(path string, data []byte, height int64, prove bool) *ctypes.ResultABCIQuery {
+	if height == 0 {
+		height = m.height
+	}
+	key := StoreKey(path, data)
+	resp := abci.ResponseQuery{Key: key, Height: height}
+	value, ok := m.state[string(key)]
+	if !ok {
+		return &ctypes.ResultABCIQuery{Response: resp}
+	}
+	resp.Value = value
+	if m.lie {
+		resp.Value = append([]byte(`"forged"`), value...)
+	}
+	if prove {
+		op := merkle.NewValueOp(key, m.proofs[string(key)]).ProofOp()
+		resp.ProofOps = &tmcrypto.ProofOps{Ops: []tmcrypto.ProofOp{op}}
+	}
+	return &ctypes.ResultABCIQuery{Response: resp}
+}
+
+func (m *mockNode) call(method string, params json.RawMessage) (interface{}, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.calls++
+	if m.down {
+		return nil, errors.New("node is down")
+	}
+	switch method {
+	case "status":
+		status := &ctypes.ResultStatus{}
+		status.SyncInfo.LatestBlockHeight = m.height
+		return status, nil
+	case "abci_query":
+		var p struct {
+			Path   string           `json:"path"`
+			Data   tmbytes.HexBytes `json:"data"`
+			Height int64            `json:"height"`
+			Prove  bool             `json:"prove"`
+		}
+		err := tmjson.Unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		return m.abciQuery(p.Path, p.Data, p.Height, p.Prove), nil
+	case "commit":
+		var p struct {
+			Height *int64 `json:"height"`
+		}
+		err := tmjson.Unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		height := m.height
+		if p.Height != nil {
+			height = *p.Height
+		}
+		if height > m.height {
+			return nil, errors.New("height is in the future")
+		}
+		sh, err := m.signedHeader(height)
+		if err != nil {
+			return nil, err
+		}
+		return ctypes.NewResultCommit(sh.Header, sh.Commit, true), nil
+	case "broadcast_tx_commit":
+		var p struct {
+			Tx tmtypes.Tx `json:"tx"`
+		}
+		err := tmjson.Unmarshal(params, &p)
+		if err != nil {
+			return nil, err
+		}
+		// the mock app takes any JSON
+		res := &ctypes.ResultBroadcastTxCommit{Hash: p.Tx.Hash()}
+		if !json.Valid(p.Tx) {
+			res.CheckTx = abci.ResponseCheckTx{Code: 1, Log: "not json"}
+			return res, nil
+		}
+		m.txs = append(m.txs, p.Tx)
+		res.Height = m.height
+		return res, nil
+	}
+	return nil, errors.New("unknown method " + method)
+}
+
+func (m *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpctypes.RPCRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := m.call(req.Method, req.Params)
+	var res rpctypes.RPCResponse
+	if err != nil {
+		res = rpctypes.RPCInternalError(req.ID, err)
+	} else {
+		res = rpctypes.NewRPCSuccessResponse(req.ID, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -1,102 +1,112 @@
 package rpc
 
-func QueryAppVersion() ([]byte, error) {
-	ret, err := ABCIQuery("/version", nil)
+import (
+	"context"
+	"fmt"
+
+	"github.com/amolabs/amo-client-go/lib/types"
+)
+
+func QueryAppVersion(ctx context.Context) ([]byte, error) {
+	ret, err := ABCIQuery(ctx, "/version", nil)
 	return ret, err
 }
 
-func QueryAppConfig() ([]byte, error) {
-	ret, err := ABCIQuery("/config", nil)
+func QueryAppConfig(ctx context.Context) ([]byte, error) {
+	ret, err := ABCIQuery(ctx, "/config", nil)
 	return ret, err
 }
 
-func QueryBalance(udc uint32, address string) ([]byte, error) {
+func QueryBalance(ctx context.Context, udc uint32, address string) ([]byte, error) {
 	queryPath := "/balance"
 	if udc != 0 {
 		queryPath = fmt.Sprintf("%s/%d", queryPath, udc)
 	}
 	address = toUpper(address)
-	ret, err := ABCIQuery(queryPath, address)
-	if ret == nil {
+	ret, err := ABCIQuery(ctx, queryPath, address)
+	if err == ErrNotFound {
+		err = nil
+	}
+	if ret == nil && err == nil {
 		ret = []byte("0")
 	}
 	return ret, err
 }
 
-func QueryUDC(udcID string) ([]byte, error) {
+func QueryUDC(ctx context.Context, udcID string) ([]byte, error) {
 	udcIDUint32, err := types.ConvIDFromStr(udcID)
 	if err != nil {
 		return nil, err
 	}
-	return ABCIQuery("/udc", udcIDUint32)
+	return ABCIQuery(ctx, "/udc", udcIDUint32)
 }
 
-func QueryUDCLock(udcID, address string) ([]byte, error) {
+func QueryUDCLock(ctx context.Context, udcID, address string) ([]byte, error) {
 	address = toUpper(address)
-	return ABCIQuery("/udclock/"+udcID, address)
+	return ABCIQuery(ctx, "/udclock/"+udcID, address)
 }
 
-func QueryStake(address string) ([]byte, error) {
+func QueryStake(ctx context.Context, address string) ([]byte, error) {
 	address = toUpper(address)
-	return ABCIQuery("/stake", address)
+	return ABCIQuery(ctx, "/stake", address)
 }
 
-func QueryDelegate(address string) ([]byte, error) {
+func QueryDelegate(ctx context.Context, address string) ([]byte, error) {
 	address = toUpper(address)
-	return ABCIQuery("/delegate", address)
+	return ABCIQuery(ctx, "/delegate", address)
 }
 
-func QueryDraft(draftID string) ([]byte, error) {
+func QueryDraft(ctx context.Context, draftID string) ([]byte, error) {
 	draftIDUint32, err := types.ConvIDFromStr(draftID)
 	if err != nil {
 		return nil, err
 	}
-	return ABCIQuery("/draft", draftIDUint32)
+	return ABCIQuery(ctx, "/draft", draftIDUint32)
 }
 
-func QueryVote(draftID, address string) ([]byte, error) {
+func QueryVote(ctx context.Context, draftID, address string) ([]byte, error) {
 	draftIDUint32, err := types.ConvIDFromStr(draftID)
 	if err != nil {
 		return nil, err
 	}
 	address = toUpper(address)
-	return ABCIQuery("/vote", struct {
+	return ABCIQuery(ctx, "/vote", struct {
 		DraftID uint32 `json:"draft_id"`
 		Voter   string `json:"voter"`
 	}{draftIDUint32, address})
 }
 
-func QueryStorage(storageID string) ([]byte, error) {
+func QueryStorage(ctx context.Context, storageID string) ([]byte, error) {
 	storageIDUint32, err := types.ConvIDFromStr(storageID)
 	if err != nil {
 		return nil, err
 	}
-	return ABCIQuery("/Storage", storageIDUint32)
+	return ABCIQuery(ctx, "/Storage", storageIDUint32)
 }
 
-func QueryParcel(parcelID string) ([]byte, error) {
+func QueryParcel(ctx context.Context, parcelID string) ([]byte, error) {
 	parcelID = toUpper(parcelID)
-	return ABCIQuery("/parcel", parcelID)
+	return ABCIQuery(ctx, "/parcel", parcelID)
 }
 
-func QueryRequest(target, recipient string) ([]byte, error) {
+func QueryRequest(ctx context.Context, target, recipient string) ([]byte, error) {
 	target = toUpper(target)
 	recipient = toUpper(recipient)
-	return ABCIQuery("/request", struct {
+	return ABCIQuery(ctx, "/request", struct {
 		Target    string `json:"target"`
 		Recipient string `json:"recipient"`
 	}{target, recipient})
 }
 
-func QueryUsage(target, recipient string) ([]byte, error) {
+func QueryUsage(ctx context.Context, target, recipient string) ([]byte, error) {
 	target = toUpper(target)
 	recipient = toUpper(recipient)
-	return ABCIQuery("/usage", struct {
+	return ABCIQuery(ctx, "/usage", struct {
 		Target    string `json:"target"`
 		Recipient string `json:"recipient"`
 	}{target, recipient})
 }
 
-func QueryDID(did string) ([]byte, error) {
-	return ABCIQuery("/did", did)
+func QueryDID(ctx context.Context, did string) ([]byte, error) {
+	return ABCIQuery(ctx, "/did", did)
 }
\ No newline at end of file
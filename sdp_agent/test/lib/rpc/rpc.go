@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmclient "github.com/tendermint/tendermint/rpc/client"
+)
+
+var (
+	RpcRemote = "tcp://0.0.0.0:26657"
+	// DryRun prints queries instead of sending them.
+	DryRun = false
+)
+
+// Result is what a node answered to an ABCI query. Verified is set only when
+// the value was proven against an app hash signed by the trusted validators.
+type Result struct {
+	Value    []byte
+	Height   int64
+	Verified bool
+}
+
+func toUpper(s string) string {
+	return strings.ToUpper(s)
+}
+
+func query(ctx context.Context, n Transport, path string, data []byte, height int64, prove bool) (*abci.ResponseQuery, error) {
+	result, err := n.ABCIQueryWithOptions(ctx, path, data,
+		tmclient.ABCIQueryOptions{Height: height, Prove: prove})
+	if err != nil {
+		return nil, err
+	}
+	if result.Response.IsErr() {
+		return nil, errors.New(result.Response.Log)
+	}
+
+	return &result.Response, nil
+}
+
+// ABCIQuery sends a query with JSON encoded data and returns the raw value.
+// When Verify is set, it fails unless the value can be proven.
+func ABCIQuery(ctx context.Context, path string, queryData interface{}) ([]byte, error) {
+	res, err := ABCIQueryResult(ctx, path, queryData)
+	if err != nil || res == nil {
+		return nil, err
+	}
+
+	return res.Value, nil
+}
+
+// ABCIQueryResult is ABCIQuery with the height and verification status of
+// the answer. It returns nil on a dry run.
+func ABCIQueryResult(ctx context.Context, path string, queryData interface{}) (*Result, error) {
+	queryJson, err := json.Marshal(queryData)
+	if err != nil {
+		return nil, err
+	}
+	if DryRun {
+		fmt.Println("query path:", path)
+		fmt.Println("query data:", string(queryJson))
+		return nil, nil
+	}
+	n, err := getTransport()
+	if err != nil {
+		return nil, err
+	}
+	if Verify {
+		return verifiedQuery(ctx, n, Trust, path, queryJson)
+	}
+	resp, err := query(ctx, n, path, queryJson, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Value: resp.Value, Height: resp.Height}, nil
+}
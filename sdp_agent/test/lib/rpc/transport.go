@@ -0,0 +1,316 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmclient "github.com/tendermint/tendermint/rpc/client"
+	tmhttp "github.com/tendermint/tendermint/rpc/client/http"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// Transport carries queries to the chain. It is the part of a Tendermint RPC
+// client the queries need, so a single node client is a Transport as is.
+type Transport interface {
+	Status(ctx context.Context) (*ctypes.ResultStatus, error)
+	ABCIQueryWithOptions(ctx context.Context, path string, data tmbytes.HexBytes,
+		opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error)
+	Commit(ctx context.Context, height *int64) (*ctypes.ResultCommit, error)
+	BroadcastTxCommit(ctx context.Context, tx tmtypes.Tx) (*ctypes.ResultBroadcastTxCommit, error)
+}
+
+var (
+	transportMtx sync.Mutex
+	transport    Transport
+)
+
+// SetTransport makes queries go through t. With nil, they go to the single
+// node at RpcRemote.
+func SetTransport(t Transport) {
+	transportMtx.Lock()
+	defer transportMtx.Unlock()
+	transport = t
+}
+
+func getTransport() (Transport, error) {
+	transportMtx.Lock()
+	t := transport
+	transportMtx.Unlock()
+	if t != nil {
+		return t, nil
+	}
+	return NewNode(RpcRemote)
+}
+
+// NewNode returns a Transport to the single node at remote.
+func NewNode(remote string) (Transport, error) {
+	return tmhttp.New(remote, "/websocket")
+}
+
+// DefaultQuorumPaths are the queries access control decisions are made on.
+var DefaultQuorumPaths = []string{"/parcel", "/request"}
+
+type endpoint struct {
+	remote  string
+	client  Transport
+	healthy bool
+}
+
+// MultiNode is a Transport over several nodes. Calls go to the first healthy
+// node in the order given and fail over to the next one on error; a node
+// that failed is tried again only after the healthy ones, until a health
+// check or a successful call brings it back.
+//
+// Queries on QuorumPaths are sent to every node instead, and succeed only if
+// at least Quorum of them give the same answer.
+type MultiNode struct {
+	Quorum      int
+	QuorumPaths []string
+
+	mtx       sync.Mutex
+	endpoints []*endpoint
+	stop      chan struct{}
+}
+
+func NewMultiNode(remotes []string) (*MultiNode, error) {
+	if len(remotes) == 0 {
+		return nil, errors.New("No RPC endpoints")
+	}
+	m := &MultiNode{
+		Quorum:      1,
+		QuorumPaths: DefaultQuorumPaths,
+	}
+	for _, remote := range remotes {
+		client, err := NewNode(remote)
+		if err != nil {
+			return nil, err
+		}
+		m.endpoints = append(m.endpoints, &endpoint{
+			remote:  remote,
+			client:  client,
+			healthy: true,
+		})
+	}
+
+	return m, nil
+}
+
+// Healthy returns the remotes currently considered healthy.
+func (m *MultiNode) Healthy() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var remotes []string
+	for _, ep := range m.endpoints {
+		if ep.healthy {
+			remotes = append(remotes, ep.remote)
+		}
+	}
+	return remotes
+}
+
+// ordered returns the healthy endpoints followed by the others.
+func (m *MultiNode) ordered() []*endpoint {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	eps := make([]*endpoint, 0, len(m.endpoints))
+	for _, ep := range m.endpoints {
+		if ep.healthy {
+			eps = append(eps, ep)
+		}
+	}
+	for _, ep := range m.endpoints {
+		if !ep.healthy {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+func (m *MultiNode) report(ep *endpoint, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	ep.healthy = err == nil
+}
+
+// HealthCheck asks every node for its status. A node is healthy if it
+// answers and is not catching up.
+func (m *MultiNode) HealthCheck(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range m.ordered() {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			status, err := ep.client.Status(ctx)
+			if err == nil && status.SyncInfo.CatchingUp {
+				err = errors.New("Catching up")
+			}
+			m.report(ep, err)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// Start runs HealthCheck every interval until Stop.
+func (m *MultiNode) Start(interval time.Duration) {
+	m.mtx.Lock()
+	if m.stop != nil {
+		m.mtx.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mtx.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				m.HealthCheck(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+func (m *MultiNode) Stop() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// failover calls fn on one node after another until it succeeds.
+func (m *MultiNode) failover(fn func(Transport) error) error {
+	var err error
+	for _, ep := range m.ordered() {
+		err = fn(ep.client)
+		m.report(ep, err)
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.New("All RPC endpoints failed, last error: " + err.Error())
+}
+
+func (m *MultiNode) Status(ctx context.Context) (*ctypes.ResultStatus, error) {
+	var res *ctypes.ResultStatus
+	err := m.failover(func(t Transport) error {
+		var err error
+		res, err = t.Status(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (m *MultiNode) Commit(ctx context.Context, height *int64) (*ctypes.ResultCommit, error) {
+	var res *ctypes.ResultCommit
+	err := m.failover(func(t Transport) error {
+		var err error
+		res, err = t.Commit(ctx, height)
+		return err
+	})
+	return res, err
+}
+
+// BroadcastTxCommit fails over like the other calls. Sending the same
+// transaction to a second node is harmless: it is either rejected as a
+// duplicate or was never received by the first.
+func (m *MultiNode) BroadcastTxCommit(ctx context.Context, tx tmtypes.Tx) (*ctypes.ResultBroadcastTxCommit, error) {
+	var res *ctypes.ResultBroadcastTxCommit
+	err := m.failover(func(t Transport) error {
+		var err error
+		res, err = t.BroadcastTxCommit(ctx, tx)
+		return err
+	})
+	return res, err
+}
+
+func (m *MultiNode) ABCIQueryWithOptions(ctx context.Context, path string, data tmbytes.HexBytes,
+	opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	if m.Quorum > 1 && m.needsQuorum(path) {
+		return m.quorumQuery(ctx, path, data, opts)
+	}
+	var res *ctypes.ResultABCIQuery
+	err := m.failover(func(t Transport) error {
+		var err error
+		res, err = t.ABCIQueryWithOptions(ctx, path, data, opts)
+		return err
+	})
+	return res, err
+}
+
+func (m *MultiNode) needsQuorum(path string) bool {
+	for _, p := range m.QuorumPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// answerKey tells apart answers that differ in anything but height and
+// proofs. Nodes a block apart answer the same query at different heights,
+// and may build proofs differently.
+func answerKey(res *ctypes.ResultABCIQuery) string {
+	r := res.Response
+	return fmt.Sprintf("%d/%X/%X", r.Code, r.Key, r.Value)
+}
+
+func (m *MultiNode) quorumQuery(ctx context.Context, path string, data tmbytes.HexBytes,
+	opts tmclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	eps := m.ordered()
+	if len(eps) < m.Quorum {
+		return nil, errors.New("Quorum of " + strconv.Itoa(m.Quorum) +
+			" needs more than " + strconv.Itoa(len(eps)) + " endpoints")
+	}
+
+	type answer struct {
+		ep  *endpoint
+		res *ctypes.ResultABCIQuery
+		err error
+	}
+	answers := make(chan answer, len(eps))
+	for _, ep := range eps {
+		go func(ep *endpoint) {
+			res, err := ep.client.ABCIQueryWithOptions(ctx, path, data, opts)
+			answers <- answer{ep, res, err}
+		}(ep)
+	}
+
+	votes := make(map[string]int)
+	best := 0
+	for range eps {
+		a := <-answers
+		m.report(a.ep, a.err)
+		if a.err != nil {
+			continue
+		}
+		k := answerKey(a.res)
+		votes[k]++
+		if votes[k] >= m.Quorum {
+			return a.res, nil
+		}
+		if votes[k] > best {
+			best = votes[k]
+		}
+	}
+
+	return nil, errors.New("No quorum for " + path + ": at most " +
+		strconv.Itoa(best) + " of " + strconv.Itoa(len(eps)) +
+		" nodes agree, " + strconv.Itoa(m.Quorum) + " required")
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func setUpNodes(t *testing.T, n int) ([]*mockNode, *MultiNode) {
+	vals, privVals := tmtypes.RandValidatorSet(4, 10)
+	var nodes []*mockNode
+	var remotes []string
+	for i := 0; i < n; i++ {
+		m := newMockNode(vals, privVals, testState)
+		nodes = append(nodes, m)
+		remotes = append(remotes, m.URL())
+	}
+	multi, err := NewMultiNode(remotes)
+	assert.NoError(t, err)
+	SetTransport(multi)
+	Trust = &TrustedState{
+		ChainID:    testChainID,
+		Validators: vals,
+		KeyOf:      StoreKey,
+	}
+	t.Cleanup(func() {
+		SetTransport(nil)
+		Verify = false
+		Trust = nil
+		for _, m := range nodes {
+			m.Close()
+		}
+	})
+	return nodes, multi
+}
+
+func TestFailover(t *testing.T) {
+	nodes, multi := setUpNodes(t, 3)
+
+	res, err := QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	assert.Equal(t, 1, nodes[0].Calls())
+	assert.Equal(t, 0, nodes[1].Calls())
+
+	nodes[0].down = true
+	res, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	assert.Equal(t, []string{nodes[1].URL(), nodes[2].URL()}, multi.Healthy())
+
+	// the failed node is now tried last
+	res, err = QueryParcel(context.Background(), "AB02")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"EF01"}`, string(res))
+	assert.Equal(t, 2, nodes[0].Calls())
+
+	// verified queries fail over too
+	Verify = true
+	r, err := ABCIQueryResult(context.Background(), "/parcel", "AB01")
+	assert.NoError(t, err)
+	assert.True(t, r.Verified)
+	Verify = false
+
+	nodes[0].down = false
+	multi.HealthCheck(context.Background())
+	assert.Equal(t, 3, len(multi.Healthy()))
+
+	nodes[2].Close()
+	multi.HealthCheck(context.Background())
+	assert.Equal(t, []string{nodes[0].URL(), nodes[1].URL()}, multi.Healthy())
+
+	nodes[0].down = true
+	nodes[1].down = true
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.Error(t, err)
+}
+
+func TestQuorum(t *testing.T) {
+	nodes, multi := setUpNodes(t, 3)
+	multi.Quorum = 2
+	nodes[1].lie = true
+
+	res, err := QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+	// the liar may still be answering
+	assert.Equal(t, 1, nodes[0].Calls())
+	assert.Equal(t, 1, nodes[2].Calls())
+
+	// other queries are answered by a single node
+	_, err = QueryStorage(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, nodes[0].Calls())
+	assert.Equal(t, 1, nodes[2].Calls())
+
+	nodes[2].down = true
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.Error(t, err)
+
+	multi.Quorum = 3
+	nodes[2].down = false
+	_, err = QueryParcel(context.Background(), "AB01")
+	assert.Error(t, err)
+
+	nodes[1].lie = false
+	res, err = QueryParcel(context.Background(), "AB01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res))
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/tendermint/tendermint/crypto/merkle"
+	tmmath "github.com/tendermint/tendermint/libs/math"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+var (
+	// Verify makes every query ask for a proof and check it against Trust.
+	Verify = false
+	Trust  *TrustedState
+	// TrustLevel is the share of the trusted voting power that must have
+	// signed a header for its app hash to be believed.
+	TrustLevel = tmmath.Fraction{Numerator: 2, Denominator: 3}
+
+	ErrNoTrust = errors.New("No trusted validator set to verify against")
+	// ErrUnverifiedAbsence is an empty answer the node sent no proof for,
+	// so that there may be a value the node is hiding.
+	ErrUnverifiedAbsence = errors.New("Node claims there is nothing there but sent no proof")
+)
+
+// TrustedState is what query results are verified against: the chain and the
+// validators believed to be honest, obtained out of band.
+type TrustedState struct {
+	ChainID    string
+	Validators *tmtypes.ValidatorSet
+	// Runtime decodes the proof operators the app returns. Nil means
+	// merkle.DefaultProofRuntime.
+	Runtime *merkle.ProofRuntime
+	// KeyOf returns the store key a query must be answered from. Without it
+	// a node could answer with a valid proof for some other key, so queries
+	// are not verified at all when it is nil.
+	KeyOf func(path string, data []byte) []byte
+}
+
+// StoreKey is the key the app proves the answer to a query under: the query
+// path and the JSON query data, joined by a colon.
+func StoreKey(path string, data []byte) []byte {
+	return []byte(path + ":" + string(data))
+}
+
+// LoadTrust reads the chain ID and validators from a genesis file. The
+// validators are trusted as they are; once the chain has changed more than
+// a third of its voting power since genesis, queries no longer verify and a
+// trusted state must be obtained anew.
+func LoadTrust(genesisPath string) (*TrustedState, error) {
+	doc, err := tmtypes.GenesisDocFromFile(genesisPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Validators) == 0 {
+		return nil, errors.New("No validators in " + genesisPath)
+	}
+	vals := make([]*tmtypes.Validator, 0, len(doc.Validators))
+	for _, v := range doc.Validators {
+		vals = append(vals, tmtypes.NewValidator(v.PubKey, v.Power))
+	}
+	valSet, err := tmtypes.ValidatorSetFromExistingValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrustedState{
+		ChainID:    doc.ChainID,
+		Validators: valSet,
+		KeyOf:      StoreKey,
+	}, nil
+}
+
+// verifyHeader returns the header at height once enough of the trusted
+// validators are found to have signed it.
+func (t *TrustedState) verifyHeader(ctx context.Context, n Transport, height int64) (*tmtypes.SignedHeader, error) {
+	res, err := n.Commit(ctx, &height)
+	if err != nil {
+		return nil, err
+	}
+	sh := res.SignedHeader
+	if sh.Header == nil || sh.Commit == nil {
+		return nil, errors.New("Incomplete signed header")
+	}
+	if sh.Height != height {
+		return nil, errors.New("Got header at height " +
+			strconv.FormatInt(sh.Height, 10) + ", asked " +
+			strconv.FormatInt(height, 10))
+	}
+	err = sh.ValidateBasic(t.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Validators.VerifyCommitLightTrusting(t.ChainID, sh.Commit, TrustLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sh, nil
+}
+
+// verifiedQuery asks for the value one block below the latest, because the
+// app hash of a state is only signed in the header of the next block. An
+// answer with no value is a verified empty Result if the node sent an
+// absence proof, and ErrUnverifiedAbsence otherwise, never ErrNotFound.
+func verifiedQuery(ctx context.Context, n Transport, t *TrustedState, path string, data []byte) (*Result, error) {
+	if t == nil {
+		return nil, ErrNoTrust
+	}
+	if t.KeyOf == nil {
+		return nil, errors.New("No store key mapping to check proofs against")
+	}
+	status, err := n.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	height := status.SyncInfo.LatestBlockHeight - 1
+	if height < 1 {
+		return nil, errors.New("Chain too short to verify queries")
+	}
+	resp, err := query(ctx, n, path, data, height, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Height != height {
+		return nil, errors.New("Query answered at height " +
+			strconv.FormatInt(resp.Height, 10) + ", asked " +
+			strconv.FormatInt(height, 10))
+	}
+	if !bytes.Equal(resp.Key, t.KeyOf(path, data)) {
+		return nil, errors.New("Proof is for another key")
+	}
+	if resp.ProofOps == nil || len(resp.ProofOps.Ops) == 0 {
+		// the app proves values only, so an empty answer comes without a
+		// proof; it is the node's word that there is nothing there
+		if len(resp.Value) == 0 {
+			return nil, ErrUnverifiedAbsence
+		}
+		return nil, errors.New("Node returned no proof")
+	}
+	sh, err := t.verifyHeader(ctx, n, height+1)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := t.Runtime
+	if rt == nil {
+		rt = merkle.DefaultProofRuntime()
+	}
+	kp := merkle.KeyPath{}.AppendKey(resp.Key, merkle.KeyEncodingURL).String()
+	if len(resp.Value) == 0 {
+		err = rt.VerifyAbsence(resp.ProofOps, sh.AppHash, kp)
+	} else {
+		err = rt.VerifyValue(resp.ProofOps, sh.AppHash, kp, resp.Value)
+	}
+	if err != nil {
+		return nil, errors.New("Proof verification failed: " + err.Error())
+	}
+
+	return &Result{Value: resp.Value, Height: resp.Height, Verified: true}, nil
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+var testState = map[string][]byte{
+	`/parcel:"AB01"`: []byte(`{"owner":"ABCD"}`),
+	`/parcel:"AB02"`: []byte(`{"owner":"EF01"}`),
+}
+
+func setUpVerify(t *testing.T) (*mockNode, *TrustedState) {
+	vals, privVals := tmtypes.RandValidatorSet(4, 10)
+	m := newMockNode(vals, privVals, testState)
+	RpcRemote = m.URL()
+	Verify = true
+	trust := &TrustedState{
+		ChainID:    testChainID,
+		Validators: vals,
+		KeyOf:      StoreKey,
+	}
+	Trust = trust
+	t.Cleanup(func() {
+		m.Close()
+		Verify = false
+		Trust = nil
+	})
+	return m, trust
+}
+
+func TestVerifiedQuery(t *testing.T) {
+	m, _ := setUpVerify(t)
+
+	res, err := ABCIQueryResult(context.Background(), "/parcel", "AB01")
+	assert.NoError(t, err)
+	assert.True(t, res.Verified)
+	assert.Equal(t, m.height-1, res.Height)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(res.Value))
+
+	parcel, err := QueryParcel(context.Background(), "ab01")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":"ABCD"}`, string(parcel))
+
+	Verify = false
+	res, err = ABCIQueryResult(context.Background(), "/parcel", "AB01")
+	assert.NoError(t, err)
+	assert.False(t, res.Verified)
+	assert.Equal(t, m.height, res.Height)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	m, trust := setUpVerify(t)
+
+	// value does not match the proof
+	m.lie = true
+	_, err := ABCIQuery(context.Background(), "/parcel", "AB01")
+	assert.Error(t, err)
+	m.lie = false
+
+	// absence cannot be proven with value proofs alone, so it is not
+	// taken for not found
+	_, err = ABCIQuery(context.Background(), "/parcel", "FFFF")
+	assert.Equal(t, ErrUnverifiedAbsence, err)
+	_, err = GetParcel(context.Background(), "FFFF")
+	assert.Equal(t, ErrUnverifiedAbsence, err)
+	_, err = QueryBalance(context.Background(), 0, "FFFF")
+	assert.Equal(t, ErrUnverifiedAbsence, err)
+
+	// proof for another key
+	trust.KeyOf = func(path string, data []byte) []byte {
+		return []byte("/parcel:\"AB02\"")
+	}
+	_, err = ABCIQuery(context.Background(), "/parcel", "AB01")
+	assert.Error(t, err)
+	// no key mapping, no verification
+	trust.KeyOf = nil
+	_, err = ABCIQuery(context.Background(), "/parcel", "AB01")
+	assert.Error(t, err)
+	trust.KeyOf = StoreKey
+
+	// headers signed by validators we do not trust
+	trust.Validators, _ = tmtypes.RandValidatorSet(4, 10)
+	_, err = ABCIQuery(context.Background(), "/parcel", "AB01")
+	assert.Error(t, err)
+
+	Trust = nil
+	_, err = ABCIQuery(context.Background(), "/parcel", "AB01")
+	assert.Equal(t, ErrNoTrust, err)
+}
+
+func TestLoadTrust(t *testing.T) {
+	vals, _ := tmtypes.RandValidatorSet(2, 10)
+	doc := &tmtypes.GenesisDoc{ChainID: testChainID}
+	for _, v := range vals.Validators {
+		doc.Validators = append(doc.Validators, tmtypes.GenesisValidator{
+			Address: v.Address,
+			PubKey:  v.PubKey,
+			Power:   v.VotingPower,
+		})
+	}
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	assert.NoError(t, doc.SaveAs(path))
+
+	trust, err := LoadTrust(path)
+	assert.NoError(t, err)
+	assert.Equal(t, testChainID, trust.ChainID)
+	assert.Equal(t, vals.Hash(), trust.Validators.Hash())
+	assert.Equal(t, StoreKey("/parcel", []byte(`"AB01"`)),
+		trust.KeyOf("/parcel", []byte(`"AB01"`)))
+}
@@ -0,0 +1,312 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+// Transaction types
+const (
+	TypeTransfer = "transfer"
+	TypeRegister = "register"
+	TypeDiscard  = "discard"
+	TypeRequest  = "request"
+	TypeCancel   = "cancel"
+	TypeGrant    = "grant"
+	TypeRevoke   = "revoke"
+)
+
+// Tx is a transaction as the AMO app takes it. Amounts are decimal strings in
+// mote, and LastHeight is a recent block height, past which the app refuses
+// to accept the transaction again. Nonce keeps two otherwise identical
+// transactions, say two transfers of the same amount, apart.
+type Tx struct {
+	Type       string          `json:"type"`
+	Sender     string          `json:"sender"`
+	Fee        string          `json:"fee"`
+	LastHeight string          `json:"last_height"`
+	Nonce      string          `json:"nonce,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	Signature  *Signature      `json:"signature,omitempty"`
+}
+
+type Signature struct {
+	PubKey   string `json:"pubkey"`
+	SigBytes string `json:"sig_bytes"`
+}
+
+type Transfer struct {
+	UDC    uint32 `json:"udc,omitempty"`
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+}
+
+type Register struct {
+	Target       string          `json:"target"`
+	Custody      string          `json:"custody"`
+	ProxyAccount string          `json:"proxy_account,omitempty"`
+	Extra        json.RawMessage `json:"extra,omitempty"`
+}
+
+type Discard struct {
+	Target string `json:"target"`
+}
+
+type Request struct {
+	Target    string          `json:"target"`
+	Payment   string          `json:"payment"`
+	Dealer    string          `json:"dealer,omitempty"`
+	DealerFee string          `json:"dealer_fee,omitempty"`
+	Extra     json.RawMessage `json:"extra,omitempty"`
+}
+
+type Cancel struct {
+	Target string `json:"target"`
+}
+
+type Grant struct {
+	Target  string          `json:"target"`
+	Grantee string          `json:"grantee"`
+	Custody string          `json:"custody"`
+	Extra   json.RawMessage `json:"extra,omitempty"`
+}
+
+type Revoke struct {
+	Grantee string `json:"grantee"`
+	Target  string `json:"target"`
+}
+
+// New returns an unsigned transaction with a zero fee.
+func New(txType string, payload interface{}) (*Tx, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{
+		Type:       txType,
+		Fee:        "0",
+		LastHeight: "0",
+		Payload:    b,
+	}, nil
+}
+
+func NewTransfer(udc uint32, to, amount string) (*Tx, error) {
+	return New(TypeTransfer, Transfer{UDC: udc, To: strings.ToUpper(to), Amount: amount})
+}
+
+func NewRegister(target string, custody []byte, extra json.RawMessage) (*Tx, error) {
+	return New(TypeRegister, Register{
+		Target:  strings.ToUpper(target),
+		Custody: strings.ToUpper(hex.EncodeToString(custody)),
+		Extra:   extra,
+	})
+}
+
+func NewDiscard(target string) (*Tx, error) {
+	return New(TypeDiscard, Discard{Target: strings.ToUpper(target)})
+}
+
+func NewRequest(target, payment string, extra json.RawMessage) (*Tx, error) {
+	return New(TypeRequest, Request{
+		Target:  strings.ToUpper(target),
+		Payment: payment,
+		Extra:   extra,
+	})
+}
+
+func NewCancel(target string) (*Tx, error) {
+	return New(TypeCancel, Cancel{Target: strings.ToUpper(target)})
+}
+
+// NewGrant gives grantee the parcel, with the data key sealed to the
+// grantee's public key as custody.
+func NewGrant(target, grantee string, custody []byte, extra json.RawMessage) (*Tx, error) {
+	return New(TypeGrant, Grant{
+		Target:  strings.ToUpper(target),
+		Grantee: strings.ToUpper(grantee),
+		Custody: strings.ToUpper(hex.EncodeToString(custody)),
+		Extra:   extra,
+	})
+}
+
+func NewRevoke(target, grantee string) (*Tx, error) {
+	return New(TypeRevoke, Revoke{
+		Grantee: strings.ToUpper(grantee),
+		Target:  strings.ToUpper(target),
+	})
+}
+
+// canonical re-encodes JSON with object keys sorted and no insignificant
+// whitespace, so that signer and verifier hash the same bytes however the
+// transaction was written down in between.
+func canonical(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	err = e.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// SignBytes returns what is signed: the canonical JSON of the transaction
+// without its signature.
+func (t *Tx) SignBytes() ([]byte, error) {
+	unsigned := *t
+	unsigned.Signature = nil
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	return canonical(b)
+}
+
+// Sign signs the transaction as the signer, who becomes its sender.
+func (t *Tx) Sign(signer keys.Signer) error {
+	if len(t.Sender) > 0 && t.Sender != signer.GetAddress() {
+		return errors.New("Tx sender is " + t.Sender + ", not " + signer.GetAddress())
+	}
+	t.Sender = signer.GetAddress()
+	msg, err := t.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(msg)
+	if err != nil {
+		return err
+	}
+	t.Signature = &Signature{
+		PubKey:   hex.EncodeToString(signer.PublicKey()),
+		SigBytes: hex.EncodeToString(sig),
+	}
+
+	return nil
+}
+
+// SignMultisig signs the transaction for a multisig sender, such as the
+// co-owners of a parcel to grant, with partial signatures the members made
+// over SignBytes.
+func (t *Tx) SignMultisig(m *keys.Multisig, partials []*keys.PartialSig) error {
+	if len(t.Sender) > 0 && t.Sender != m.Address() {
+		return errors.New("Tx sender is " + t.Sender + ", not " + m.Address())
+	}
+	t.Sender = m.Address()
+	msg, err := t.SignBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := m.Combine(msg, partials)
+	if err != nil {
+		return err
+	}
+	t.Signature = &Signature{
+		PubKey:   hex.EncodeToString(m.Encode()),
+		SigBytes: hex.EncodeToString(sig),
+	}
+
+	return nil
+}
+
+// Verify checks that the transaction was signed by its sender.
+func (t *Tx) Verify() error {
+	if t.Signature == nil {
+		return errors.New("Tx is not signed")
+	}
+	pubKey, err := hex.DecodeString(t.Signature.PubKey)
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(t.Signature.SigBytes)
+	if err != nil {
+		return err
+	}
+	// accounts are addressed by the uncompressed key, multisig accounts by
+	// their encoding
+	addrKey := pubKey
+	if !keys.IsMultisig(pubKey) {
+		addrKey, err = keys.DecompressPubKey(pubKey)
+		if err != nil {
+			return err
+		}
+	}
+	if keys.DeriveAddress(addrKey) != t.Sender {
+		return errors.New("Tx signed by another key than the sender's")
+	}
+	msg, err := t.SignBytes()
+	if err != nil {
+		return err
+	}
+	if !keys.VerifyAccount(pubKey, msg, sig) {
+		return errors.New("Invalid tx signature")
+	}
+
+	return nil
+}
+
+func (t *Tx) SetLastHeight(height int64) {
+	t.LastHeight = strconv.FormatInt(height, 10)
+}
+
+// SetNonce sets a fresh random nonce.
+func (t *Tx) SetNonce() error {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	t.Nonce = strings.ToUpper(hex.EncodeToString(b))
+	return nil
+}
+
+// Encode returns the transaction as sent to the chain.
+func (t *Tx) Encode() ([]byte, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return canonical(b)
+}
+
+func Decode(b []byte) (*Tx, error) {
+	var t Tx
+	err := json.Unmarshal(b, &t)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Type) == 0 {
+		return nil, errors.New("No tx type")
+	}
+	return &t, nil
+}
+
+// Broadcast sends a signed transaction and waits for it to be committed.
+func (t *Tx) Broadcast(ctx context.Context) (*ctypes.ResultBroadcastTxCommit, error) {
+	err := t.Verify()
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return rpc.BroadcastTx(ctx, b)
+}
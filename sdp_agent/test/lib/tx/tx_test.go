@@ -0,0 +1,145 @@
+package tx
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/amolabs/amo-client-go/lib/keys"
+	"github.com/amolabs/amo-client-go/lib/rpc"
+)
+
+func TestSign(t *testing.T) {
+	key, err := keys.GenerateKey("tx test", nil, false)
+	assert.NoError(t, err)
+	other, err := keys.GenerateKey("tx test other", nil, false)
+	assert.NoError(t, err)
+
+	tx, err := NewGrant("ab01", other.Address, []byte{0xc0, 0xff, 0xee}, json.RawMessage(`{"b":1,"a":2}`))
+	assert.NoError(t, err)
+	tx.Fee = "10"
+	tx.SetLastHeight(42)
+	assert.Error(t, tx.Verify())
+	assert.NoError(t, tx.Sign(key))
+	assert.Equal(t, key.Address, tx.Sender)
+	assert.NoError(t, tx.Verify())
+
+	b, err := tx.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"fee":"10","last_height":"42","payload":{"custody":"C0FFEE","extra":{"a":2,"b":1},"grantee":"`+
+		other.Address+`","target":"AB01"},"sender":"`+key.Address+`","signature":{"pubkey":"`+
+		tx.Signature.PubKey+`","sig_bytes":"`+tx.Signature.SigBytes+`"},"type":"grant"}`, string(b))
+
+	// the signature survives reformatting
+	var v interface{}
+	assert.NoError(t, json.Unmarshal(b, &v))
+	indented, err := json.MarshalIndent(v, "", "  ")
+	assert.NoError(t, err)
+	decoded, err := Decode(indented)
+	assert.NoError(t, err)
+	assert.NoError(t, decoded.Verify())
+
+	// but not tampering
+	decoded.Fee = "1"
+	assert.Error(t, decoded.Verify())
+	decoded, _ = Decode(b)
+	decoded.Sender = other.Address
+	assert.Error(t, decoded.Verify())
+
+	// the compressed key is the same sender
+	decoded, _ = Decode(b)
+	compressed, err := keys.CompressPubKey(key.PubKey)
+	assert.NoError(t, err)
+	decoded.Signature.PubKey = hex.EncodeToString(compressed)
+	assert.NoError(t, decoded.Verify())
+
+	// a signer other than the sender
+	tx, _ = NewRevoke("AB01", other.Address)
+	tx.Sender = other.Address
+	assert.Error(t, tx.Sign(key))
+
+	_, err = Decode([]byte(`{"sender":"AB"}`))
+	assert.Error(t, err)
+}
+
+func TestOffline(t *testing.T) {
+	key, _ := keys.GenerateKey("tx test", nil, false)
+
+	// generated online, with no key at hand
+	tx, err := NewTransfer(0, "abcd", "100")
+	assert.NoError(t, err)
+	tx.Sender = key.Address
+	tx.SetLastHeight(42)
+	assert.NoError(t, tx.SetNonce())
+	assert.Equal(t, 16, len(tx.Nonce))
+	b, err := json.Marshal(tx)
+	assert.NoError(t, err)
+
+	// signed offline
+	unsigned, err := Decode(b)
+	assert.NoError(t, err)
+	assert.NoError(t, unsigned.Sign(key))
+	b, err = json.Marshal(unsigned)
+	assert.NoError(t, err)
+
+	// broadcast online
+	signed, err := Decode(b)
+	assert.NoError(t, err)
+	assert.NoError(t, signed.Verify())
+	assert.Equal(t, tx.Nonce, signed.Nonce)
+
+	// the nonce is signed for
+	nonce := signed.Nonce
+	assert.NoError(t, signed.SetNonce())
+	assert.NotEqual(t, nonce, signed.Nonce)
+	assert.Error(t, signed.Verify())
+}
+
+func TestMultisig(t *testing.T) {
+	city, _ := keys.GenerateKey("city", nil, false)
+	operator, _ := keys.GenerateKey("operator", nil, false)
+	m, err := keys.NewMultisig(2, [][]byte{city.PubKey, operator.PubKey})
+	assert.NoError(t, err)
+
+	tx, err := NewGrant("AB01", "CDEF", []byte{0x01}, nil)
+	assert.NoError(t, err)
+	tx.Sender = m.Address()
+	msg, err := tx.SignBytes()
+	assert.NoError(t, err)
+	p1, err := m.SignPartial(city, msg)
+	assert.NoError(t, err)
+	assert.Error(t, tx.SignMultisig(m, []*keys.PartialSig{p1}))
+	assert.Error(t, tx.Verify())
+	p2, err := m.SignPartial(operator, msg)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.SignMultisig(m, []*keys.PartialSig{p1, p2}))
+	assert.NoError(t, tx.Verify())
+
+	// one co-owner alone is not the sender
+	assert.Error(t, tx.Sign(city))
+
+	signer, _ := keys.NewMultisigSigner(m, city, operator)
+	tx, _ = NewRevoke("AB01", "CDEF")
+	assert.NoError(t, tx.Sign(signer))
+	assert.Equal(t, m.Address(), tx.Sender)
+	assert.NoError(t, tx.Verify())
+}
+
+func TestBroadcastDryRun(t *testing.T) {
+	key, _ := keys.GenerateKey("tx test", nil, false)
+	tx, err := NewTransfer(0, "abcd", "100")
+	assert.NoError(t, err)
+
+	rpc.DryRun = true
+	defer func() { rpc.DryRun = false }()
+
+	_, err = tx.Broadcast(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, tx.Sign(key))
+	res, err := tx.Broadcast(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+}